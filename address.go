@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"strings"
+
+	"github.com/stxpub/codec"
+)
+
+// Addresses are only parsed to tell valid ones apart from garbage, neither
+// the codec nor the standard library decode them.
+
+const (
+	c32Alphabet    = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// decodeBase decodes s as a big endian number in the given alphabet, where
+// each leading zero digit stands for a leading zero byte.
+func decodeBase(s, alphabet string) ([]byte, bool) {
+	n := new(big.Int)
+	base := big.NewInt(int64(len(alphabet)))
+	for _, c := range s {
+		i := strings.IndexRune(alphabet, c)
+		if i < 0 {
+			return nil, false
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(i)))
+	}
+	zeros := len(s) - len(strings.TrimLeft(s, alphabet[:1]))
+	return append(make([]byte, zeros), n.Bytes()...), true
+}
+
+// parseStacksAddress parses a c32check encoded Stacks address
+func parseStacksAddress(s string) (codec.Address, bool) {
+	var addr codec.Address
+	if len(s) < 3 || s[0] != 'S' {
+		return addr, false
+	}
+	version := strings.IndexByte(c32Alphabet, s[1])
+	data, ok := decodeBase(s[2:], c32Alphabet)
+	// hash and checksum
+	if version < 0 || !ok || len(data) != 24 {
+		return addr, false
+	}
+	addr.Version = codec.AddressVersion(version)
+	copy(addr.HashBytes[:], data)
+	// Encoding it back checks the checksum
+	return addr, addr.ToStacks() == s
+}
+
+// validBitcoinAddress reports whether s is a mainnet, testnet or regtest
+// Bitcoin address
+func validBitcoinAddress(s string) bool {
+	lower := strings.ToLower(s)
+	for _, hrp := range []string{"bc1", "tb1", "bcrt1"} {
+		if strings.HasPrefix(lower, hrp) {
+			return (s == lower || s == strings.ToUpper(s)) && validSegwitAddress(hrp[:len(hrp)-1], lower[len(hrp):])
+		}
+	}
+
+	// base58check P2PKH or P2SH: version, hash and checksum
+	data, ok := decodeBase(s, base58Alphabet)
+	if !ok || len(data) != 25 {
+		return false
+	}
+	switch data[0] {
+	case 0x00, 0x05, 0x6f, 0xc4:
+	default:
+		return false
+	}
+	hash := sha256.Sum256(data[:21])
+	hash = sha256.Sum256(hash[:])
+	return bytes.Equal(hash[:4], data[21:])
+}
+
+// validSegwitAddress checks data, the part of a bech32 or bech32m address
+// after its separator, as BIP 173 and BIP 350 specify it.
+func validSegwitAddress(hrp, data string) bool {
+	if len(data) < 7 {
+		return false
+	}
+	values := make([]byte, len(data))
+	for i := range data {
+		v := strings.IndexByte(bech32Alphabet, data[i])
+		if v < 0 {
+			return false
+		}
+		values[i] = byte(v)
+	}
+
+	// Checksum over the expanded human readable part and the data
+	var expanded []byte
+	for i := range hrp {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := range hrp {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	chk := uint32(1)
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	for _, v := range append(expanded, values...) {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := range generator {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+
+	// Witness version, then the program regrouped from 5 to 8 bits
+	witnessVersion := values[0]
+	var program []byte
+	var acc uint32
+	bits := 0
+	for _, v := range values[1 : len(values)-6] {
+		acc = acc<<5 | uint32(v)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			program = append(program, byte(acc>>bits))
+		}
+	}
+	if bits >= 5 || acc&(1<<bits-1) != 0 {
+		return false
+	}
+
+	switch {
+	case witnessVersion == 0:
+		return chk == 1 && (len(program) == 20 || len(program) == 32)
+	case witnessVersion <= 16:
+		return chk == 0x2bc830a3 && len(program) >= 2 && len(program) <= 40
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stxpub/codec"
+)
+
+func TestParseStacksAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+		version codec.AddressVersion
+	}{
+		{"SP2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKNRV9EJ7", true, codec.MainnetSingleSig},
+		{"SM2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKQVX8X0G", true, codec.MainnetMultiSig},
+		{"ST2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKQYAC0RQ", true, codec.TestnetSingleSig},
+		{"SN2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKP6D2ZK9", true, codec.TestnetMultiSig},
+		{"SP000000000000000000002Q6VF78", true, codec.MainnetSingleSig},
+		// bad checksum
+		{"SP2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKNRV9EJ8", false, 0},
+		// not in the c32 alphabet
+		{"SP2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKNRV9EJU", false, 0},
+		{"SP2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKK", false, 0},
+		{"sp2j6zy48gv1ez5v2v5rb9mp66sw86pykknrv9ej7", false, 0},
+		{"S", false, 0},
+		{"", false, 0},
+		{"garbage", false, 0},
+	}
+	for _, tt := range tests {
+		addr, ok := parseStacksAddress(tt.address)
+		if ok != tt.valid {
+			t.Errorf("parseStacksAddress(%q) valid = %v, want %v", tt.address, ok, tt.valid)
+			continue
+		}
+		if ok && addr.Version != tt.version {
+			t.Errorf("parseStacksAddress(%q) version = %v, want %v", tt.address, addr.Version, tt.version)
+		}
+	}
+}
+
+func TestParseStacksAddressRoundTrip(t *testing.T) {
+	for _, hash := range [][20]byte{{}, {0, 0, 1}, {0xff, 1, 2, 3}} {
+		want := codec.Address{Version: codec.MainnetSingleSig, HashBytes: hash}
+		got, ok := parseStacksAddress(want.ToStacks())
+		if !ok || got != want {
+			t.Errorf("parseStacksAddress(%q) = %v, %v, want %v", want.ToStacks(), got, ok, want)
+		}
+	}
+}
+
+func TestValidBitcoinAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		// base58check P2PKH and P2SH, mainnet and testnet
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", true},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", true},
+		{"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", true},
+		{"2MzQwSSnBHWHqSAqtTVQ6v47XtaisrJa1Vc", true},
+		// bech32 segwit v0, BIP 173
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", true},
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", true},
+		{"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3", true},
+		{"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", true},
+		// bech32m segwit v1, BIP 350
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", true},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", true},
+		// bad base58 checksum
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", false},
+		// unknown base58 version
+		{"4J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", false},
+		// bad bech32 checksum
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", false},
+		// mixed case
+		{"Bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", false},
+		// v0 with a bech32m checksum, BIP 350
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", false},
+		// v1 with a bech32 checksum, BIP 350
+		{"bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4", false},
+		// unknown human readable part
+		{"ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", false},
+		{"bc1qaaaaaaaaaa", false},
+		{"", false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		if got := validBitcoinAddress(tt.address); got != tt.valid {
+			t.Errorf("validBitcoinAddress(%q) = %v, want %v", tt.address, got, tt.valid)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"log/slog"
@@ -14,6 +15,9 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -26,12 +30,13 @@ import (
 	"github.com/madflojo/tasks"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pelletier/go-toml/v2"
-	"github.com/stxpub/codec"
 )
 
 type Config struct {
 	DataDir string
 	CMCKey  string
+	// Optional webhook that new fork events are POSTed to
+	ForkAlertURL string
 }
 
 func (c Config) validate() {
@@ -43,42 +48,643 @@ func (c Config) validate() {
 
 var config Config
 
-// Map from miner's STX payout address to their Bitcoin address
+// Map from miner's STX payout address to their most recently seen Bitcoin address
 var minerAddressMap sync.Map
 
+// Map from miner's Bitcoin address to their STX payout address. Several
+// Bitcoin addresses may pay out to the same STX address.
+var minerSenderMap sync.Map
+
 type DotResponse struct {
 	Timestamp          time.Time `db:"timestamp"`
 	BitcoinBlockHeight int       `db:"bitcoin_block_height"`
 	Dot                string    `db:"dot"`
 }
 
-func handleMinerViz(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// heightFilter returns a WHERE clause and its arguments restricting a query
+// to the Bitcoin block height in the {height} URL parameter, or nothing if
+// the route has no height.
+func heightFilter(r *http.Request) (string, []any, error) {
+	v := chi.URLParam(r, "height")
+	if v == "" {
+		return "", nil, nil
+	}
+	height, err := strconv.Atoi(v)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid height: %q", v)
+	}
+	return " WHERE bitcoin_block_height = ?", []any{height}, nil
+}
 
+// fetchLatest loads into dest the newest row returned by query, restricted to
+// the height in the URL if there is one. It writes an error response and
+// returns false if the height is invalid or has no rows.
+func fetchLatest(w http.ResponseWriter, r *http.Request, hubDb *sqlx.DB, dest any, query string) bool {
+	where, args, err := heightFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	q := query + where + " ORDER BY timestamp DESC LIMIT 1"
+	if err := hubDb.Get(dest, q, args...); err != nil {
+		slog.Warn("Error fetching", "query", q, "error", err)
+		if args != nil && errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "No graph at that height", http.StatusNotFound)
+			return false
+		}
+	}
+	return true
+}
+
+func handleMinerViz(w http.ResponseWriter, r *http.Request) {
 	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
 	defer hubDb.Close()
 
 	var d DotResponse
-	q := "SELECT timestamp, bitcoin_block_height, dot FROM dots ORDER BY timestamp DESC LIMIT 1"
-	if err := hubDb.Get(&d, q); err != nil {
-		slog.Warn("Error fetching", "query", q, "error", err)
+	if !fetchLatest(w, r, hubDb, &d, "SELECT timestamp, bitcoin_block_height, dot FROM dots") {
+		return
 	}
 
 	// Marshal d as JSON and write it to the response
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleMinerVizRange(w http.ResponseWriter, r *http.Request) {
+	db, cdb := openDatabases()
+	defer db.Close()
+	defer cdb.Close()
+
+	lowerBound, upperBound, err := sortitionRange(r, db, defaultGraphRangeBlocks, maxGraphRangeBlocks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g, err := buildRangeGraph(db, cdb, lowerBound, upperBound)
+	if err != nil {
+		slog.Warn("Error building graph", "from", lowerBound+1, "to", upperBound, "error", err)
+		http.Error(w, "Failed to build graph", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	d := DotResponse{Timestamp: g.built, BitcoinBlockHeight: upperBound, Dot: g.dot}
 	if err := json.NewEncoder(w).Encode(d); err != nil {
 		slog.Warn("Error encoding JSON", "error", err)
 	}
 }
 
+func handleMinerGraphRange(w http.ResponseWriter, r *http.Request) {
+	db, cdb := openDatabases()
+	defer db.Close()
+	defer cdb.Close()
+
+	lowerBound, upperBound, err := sortitionRange(r, db, defaultGraphRangeBlocks, maxGraphRangeBlocks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g, err := buildRangeGraph(db, cdb, lowerBound, upperBound)
+	if err != nil {
+		slog.Warn("Error building graph", "from", lowerBound+1, "to", upperBound, "error", err)
+		http.Error(w, "Failed to build graph", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Timestamp          time.Time
+		BitcoinBlockHeight int
+		Graph              Graph
+	}{g.built, upperBound, g.graph}); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+type VizHeight struct {
+	BitcoinBlockHeight int       `db:"bitcoin_block_height"`
+	Timestamp          time.Time `db:"timestamp"`
+	Runs               int       `db:"runs"`
+}
+
+func handleMinerVizHeights(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	heights := []VizHeight{}
+	// Select the newest row per height as is, so the timestamp keeps its type
+	q := `SELECT
+		d.bitcoin_block_height,
+		d.timestamp,
+		(SELECT COUNT(*) FROM dots WHERE bitcoin_block_height = d.bitcoin_block_height) AS runs
+	FROM dots d
+	WHERE d.id IN (SELECT MAX(id) FROM dots GROUP BY bitcoin_block_height)
+	ORDER BY d.bitcoin_block_height DESC`
+	if err := hubDb.Select(&heights, q); err != nil {
+		slog.Warn("Error fetching", "query", q, "error", err)
+	}
+	if err := json.NewEncoder(w).Encode(heights); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+type GraphResponse struct {
+	Timestamp          time.Time       `db:"timestamp"`
+	BitcoinBlockHeight int             `db:"bitcoin_block_height"`
+	Graph              json.RawMessage `db:"data"`
+}
+
+func handleMinerGraph(w http.ResponseWriter, r *http.Request) {
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	var g GraphResponse
+	if !fetchLatest(w, r, hubDb, &g, "SELECT timestamp, bitcoin_block_height, data FROM graphs") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(g); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleMinerVizSVG(w http.ResponseWriter, r *http.Request) {
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	var g GraphResponse
+	if !fetchLatest(w, r, hubDb, &g, "SELECT timestamp, bitcoin_block_height, data FROM graphs") {
+		return
+	}
+	if g.Graph == nil {
+		http.Error(w, "No graph available", http.StatusNotFound)
+		return
+	}
+
+	image, err := cachedGraphSVG(g.BitcoinBlockHeight, func() ([]byte, error) {
+		var graph Graph
+		if err := json.Unmarshal(g.Graph, &graph); err != nil {
+			return nil, err
+		}
+		return renderGraphSVG(graph), nil
+	})
+	if err != nil {
+		slog.Warn("Error rendering graph", "height", g.BitcoinBlockHeight, "error", err)
+		http.Error(w, "Failed to render graph", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(image)
+}
+
+const (
+	// Default window for /miners/power, one day of Bitcoin blocks
+	defaultMinerPowerBlocks = 144
+	// Largest window /miners/power will compute, roughly a month
+	maxMinerPowerBlocks = 144 * 30
+	// Default window for /miners/power/history, one week of Bitcoin blocks
+	defaultMinerPowerHistoryBlocks = 144 * 7
+	// Largest window /miners/power/history will return, roughly a year
+	maxMinerPowerHistoryBlocks = 144 * 365
+	// Largest window /miners/{address} will walk, roughly a week
+	maxMinerDetailBlocks = 144 * 7
+	// Default and largest windows for /events/forks
+	defaultForkEventBlocks = 144
+	maxForkEventBlocks     = 144 * 365
+	// Default and largest windows for /miners/viz/range and /miners/graph/range
+	defaultGraphRangeBlocks = 20
+	maxGraphRangeBlocks     = 144
+	// Largest number of snapshots returned by /mempool/stats, a day's worth
+	maxMempoolSnapshots = 720
+	// Largest /tx/decode/batch request body
+	maxDecodeBatchBytes = 64 << 20
+)
+
+// intParam parses the query parameter name as an integer, returning def when
+// the parameter is absent.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return i, nil
+}
+
+// timeParam parses the query parameter name as either a Unix timestamp or an
+// RFC 3339 time. The second return value is false when the parameter is absent.
+func timeParam(r *http.Request, name string) (time.Time, bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(unix, 0), true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, true, fmt.Errorf("invalid %s: %q, expected a Unix timestamp or RFC 3339 time", name, v)
+	}
+	return t, true, nil
+}
+
+// heightRange resolves the blocks, from and to query parameters into an
+// exclusive lower and inclusive upper burn height, given the current tip.
+// from takes precedence over blocks when both are set, and the window may
+// not be larger than maxBlocks.
+func heightRange(r *http.Request, tip, defBlocks, maxBlocks int) (int, int, error) {
+	blocks, err := intParam(r, "blocks", defBlocks)
+	if err != nil {
+		return 0, 0, err
+	}
+	if blocks < 1 {
+		return 0, 0, fmt.Errorf("blocks must be positive, got %d", blocks)
+	}
+	to, err := intParam(r, "to", tip)
+	if err != nil {
+		return 0, 0, err
+	}
+	if to > tip {
+		to = tip
+	}
+	from, err := intParam(r, "from", to-blocks+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("from %d is after to %d", from, to)
+	}
+	if to-from+1 > maxBlocks {
+		return 0, 0, fmt.Errorf("window of %d blocks exceeds limit of %d", to-from+1, maxBlocks)
+	}
+	return from - 1, to, nil
+}
+
+// sortitionRange is heightRange bounded below by the first burn height with a
+// sortition, as the block commit pipeline expects a snapshot at every height.
+func sortitionRange(r *http.Request, db *sqlx.DB, defBlocks, maxBlocks int) (int, int, error) {
+	var tip int
+	if err := db.Get(&tip, "SELECT COALESCE(MAX(block_height), 0) FROM block_commits"); err != nil {
+		return 0, 0, err
+	}
+	lowerBound, upperBound, err := heightRange(r, tip, defBlocks, maxBlocks)
+	if err != nil {
+		return 0, 0, err
+	}
+	var first int
+	if err := db.Get(&first, "SELECT MIN(block_height) FROM snapshots"); err != nil {
+		return 0, 0, err
+	}
+	if lowerBound+1 < first {
+		return 0, 0, fmt.Errorf("from must be at least %d", first)
+	}
+	return lowerBound, upperBound, nil
+}
+
 func handleMinerPower(w http.ResponseWriter, r *http.Request) {
+	db, cdb := openDatabases()
+	defer db.Close()
+	defer cdb.Close()
+
+	tip, _ := getBlockRange(db, 0)
+	lowerBound, upperBound, err := heightRange(r, tip, defaultMinerPowerBlocks, maxMinerPowerBlocks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(queryMinerPower(db, cdb, lowerBound, upperBound)); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleMinerPowerHistory(w http.ResponseWriter, r *http.Request) {
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	var tip int
+	q := "SELECT COALESCE(MAX(bitcoin_block_height), 0) FROM miner_power"
+	if err := hubDb.Get(&tip, q); err != nil {
+		slog.Warn("Error fetching", "query", q, "error", err)
+	}
+	lowerBound, upperBound, err := heightRange(r, tip, defaultMinerPowerHistoryBlocks, maxMinerPowerHistoryBlocks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(getMinerPowerHistory(hubDb, lowerBound, upperBound)); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleMinerDetail(w http.ResponseWriter, r *http.Request) {
+	stxAddr, btcAddr, ok := resolveMinerAddress(chi.URLParam(r, "address"))
+	if !ok || btcAddr == "" {
+		http.Error(w, "Unknown miner", http.StatusNotFound)
+		return
+	}
+	btcAddrs := []string{btcAddr}
+	if stxAddr != "" {
+		hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+		defer hubDb.Close()
+		known, err := minerBitcoinAddresses(hubDb, stxAddr)
+		if err != nil {
+			slog.Warn("Error fetching miner addresses", "stx", stxAddr, "error", err)
+		}
+		if len(known) > 0 {
+			btcAddrs = known
+		}
+	}
+
+	db, cdb := openDatabases()
+	defer db.Close()
+	defer cdb.Close()
+
+	lowerBound, upperBound, err := sortitionRange(r, db, defaultMinerPowerBlocks, maxMinerDetailBlocks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	detail, err := queryMinerDetail(db, cdb, stxAddr, btcAddrs, lowerBound, upperBound)
+	if err != nil {
+		slog.Warn("Error querying miner", "address", stxAddr, "error", err)
+		http.Error(w, "Failed to query miner", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleMinerAddresses(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	addresses := []MinerAddress{}
+	q := `SELECT stacks_recipient, bitcoin_address, first_seen, last_seen
+	FROM miner_addresses ORDER BY last_seen DESC`
+	if err := hubDb.Select(&addresses, q); err != nil {
+		slog.Warn("Error fetching", "query", q, "error", err)
+	}
+	if err := json.NewEncoder(w).Encode(addresses); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleForkEvents(w http.ResponseWriter, r *http.Request) {
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	var tip int
+	q := "SELECT COALESCE(MAX(bitcoin_block_height), 0) FROM fork_events"
+	if err := hubDb.Get(&tip, q); err != nil {
+		slog.Warn("Error fetching", "query", q, "error", err)
+	}
+	lowerBound, upperBound, err := heightRange(r, tip, defaultForkEventBlocks, maxForkEventBlocks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	eventType := r.URL.Query().Get("type")
+	switch eventType {
+	case "", OrphanedTenure, StaleParent, NoCanonicalWinner:
+	default:
+		http.Error(w, fmt.Sprintf("invalid type: %q", eventType), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(getForkEvents(hubDb, lowerBound, upperBound, eventType)); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
 
-	if err := json.NewEncoder(w).Encode(queryMinerPower()); err != nil {
+func handleMempoolTxs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseMempoolFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", defaultMempoolPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit < 1 || limit > maxMempoolPageSize || offset < 0 {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d and offset not negative", maxMempoolPageSize),
+			http.StatusBadRequest)
+		return
+	}
+
+	mempool, ok := currentMempool()
+	if !ok {
+		http.Error(w, "Mempool not read yet", http.StatusServiceUnavailable)
+		return
+	}
+	txs := slices.DeleteFunc(mempool, func(tx MempoolTx) bool {
+		return !filter.match(tx)
+	})
+	if !sortMempoolTxs(txs, r.URL.Query().Get("sort"), r.URL.Query().Get("order") == "asc") {
+		http.Error(w, "sort must be one of fee_rate, fee or age", http.StatusBadRequest)
+		return
+	}
+
+	page := MempoolTxPage{Total: len(txs), Offset: offset, Limit: limit, Transactions: []MempoolTx{}}
+	if offset < len(txs) {
+		page.Transactions = txs[offset:min(offset+limit, len(txs))]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleMempoolTx(w http.ResponseWriter, r *http.Request) {
+	detail, found, err := findMempoolTx(chi.URLParam(r, "txid"))
+	if err != nil {
+		http.Error(w, "Mempool not read yet", http.StatusServiceUnavailable)
+		return
+	}
+	if !found {
+		http.Error(w, "Transaction not in mempool", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
 		slog.Warn("Error encoding JSON", "error", err)
 	}
 }
 
+func handleMempoolStuck(w http.ResponseWriter, r *http.Request) {
+	blocks, err := intParam(r, "blocks", defaultStuckBurnBlocks)
+	if err == nil && (blocks < 1 || blocks > maxStuckBurnBlocks) {
+		err = fmt.Errorf("blocks must be between 1 and %d, got %d", maxStuckBurnBlocks, blocks)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	maxAge, err := burnBlockAge(blocks - 1)
+	if err != nil {
+		slog.Warn("Error fetching Bitcoin block time", "blocks", blocks, "error", err)
+		http.Error(w, "Failed to fetch Bitcoin blocks", http.StatusInternalServerError)
+		return
+	}
+	mempool, ok := currentMempool()
+	if !ok {
+		http.Error(w, "Mempool not read yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The node may keep mined transactions around, don't count them as stuck
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+	confirmed, err := confirmedTxids(hubDb)
+	if err != nil {
+		slog.Warn("Error fetching confirmed transactions", "error", err)
+	}
+
+	// Without the node's nonce cache, only gaps between mempool transactions
+	// are found
+	nonces, err := accountNonces()
+	if err != nil {
+		slog.Warn("Error fetching account nonces", "error", err)
+	}
+
+	sender := r.URL.Query().Get("sender")
+	txs := slices.DeleteFunc(mempool, func(tx MempoolTx) bool {
+		return confirmed[tx.Txid] || (sender != "" && tx.Sender != sender)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(findStuckChains(txs, nonces, maxAge)); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+// MempoolSnapshot is a mempool_stats row, Data being a MempoolData
+type MempoolSnapshot struct {
+	Timestamp time.Time       `db:"timestamp"`
+	Count     int             `db:"count"`
+	Data      json.RawMessage `db:"data"`
+}
+
 func handleMempoolStats(w http.ResponseWriter, r *http.Request) {
+	at, hasAt, err := timeParam(r, "at")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, hasFrom, err := timeParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, hasTo, err := timeParam(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hasAt && (hasFrom || hasTo) {
+		http.Error(w, "at can't be combined with from and to", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	switch {
+	case hasAt:
+		var snapshot MempoolSnapshot
+		q := "SELECT timestamp, count, data FROM mempool_stats ORDER BY ABS(unixepoch(timestamp) - ?) LIMIT 1"
+		if err := hubDb.Get(&snapshot, q, at.Unix()); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "No mempool snapshots", http.StatusNotFound)
+				return
+			}
+			slog.Warn("Error fetching", "query", q, "error", err)
+		}
+		if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+			slog.Warn("Error encoding JSON", "error", err)
+		}
+		return
+
+	case hasFrom || hasTo:
+		if !hasTo {
+			to = time.Now()
+		}
+		if to.Before(from) {
+			http.Error(w, "from must not be after to", http.StatusBadRequest)
+			return
+		}
+		fromArg, toArg := from.UTC().Format(time.DateTime), to.UTC().Format(time.DateTime)
+		var count int
+		q := "SELECT COUNT(*) FROM mempool_stats WHERE timestamp >= ? AND timestamp <= ?"
+		if err := hubDb.Get(&count, q, fromArg, toArg); err != nil {
+			slog.Warn("Error fetching", "query", q, "error", err)
+			http.Error(w, "Failed to fetch mempool snapshots", http.StatusInternalServerError)
+			return
+		}
+		if count > maxMempoolSnapshots {
+			http.Error(w, fmt.Sprintf("from and to span %d snapshots, more than the maximum of %d",
+				count, maxMempoolSnapshots), http.StatusBadRequest)
+			return
+		}
+		snapshots := []MempoolSnapshot{}
+		q = `SELECT timestamp, count, data FROM mempool_stats
+		WHERE timestamp >= ? AND timestamp <= ?
+		ORDER BY timestamp DESC LIMIT ?`
+		if err := hubDb.Select(&snapshots, q, fromArg, toArg, maxMempoolSnapshots); err != nil {
+			slog.Warn("Error fetching", "query", q, "error", err)
+		}
+		if err := json.NewEncoder(w).Encode(snapshots); err != nil {
+			slog.Warn("Error encoding JSON", "error", err)
+		}
+		return
+	}
+
+	var jsonBlob []byte
+	q := "SELECT data FROM mempool_stats ORDER BY timestamp DESC LIMIT 1"
+	if err := hubDb.Get(&jsonBlob, q); err != nil {
+		slog.Warn("Error fetching", "query", q, "error", err)
+	}
+	// Write the JSON blob to the response
+	w.Write(jsonBlob)
+}
+
+func handleMempoolBreakdown(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("type")
+	if category != "" && !slices.Contains(payloadCategories, category) {
+		http.Error(w, "type must be one of "+strings.Join(payloadCategories, ", "), http.StatusBadRequest)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 
 	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
@@ -89,23 +695,119 @@ func handleMempoolStats(w http.ResponseWriter, r *http.Request) {
 	if err := hubDb.Get(&jsonBlob, q); err != nil {
 		slog.Warn("Error fetching", "query", q, "error", err)
 	}
+	var d MempoolData
+	if len(jsonBlob) > 0 {
+		if err := json.Unmarshal(jsonBlob, &d); err != nil {
+			slog.Warn("Error decoding mempool stats", "error", err)
+		}
+	}
+
+	// Optionally only return one payload category
+	breakdown := d.Breakdown
+	if category != "" {
+		breakdown = map[string][]MempoolBucket{category: d.Breakdown[category]}
+	}
+	if err := json.NewEncoder(w).Encode(breakdown); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleMempoolChurn(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	hours, err := intParam(r, "hours", defaultChurnHours)
+	if err == nil && (hours < 1 || hours > maxChurnHours) {
+		err = fmt.Errorf("hours must be between 1 and %d, got %d", maxChurnHours, hours)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour).Unix()
+	churn, err := getMempoolChurn(hubDb, since)
+	if err != nil {
+		slog.Warn("Error fetching mempool churn", "error", err)
+	}
+	if err := json.NewEncoder(w).Encode(churn); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleFeeEstimate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
+	defer hubDb.Close()
+
+	var jsonBlob []byte
+	q := "SELECT data FROM fee_estimates ORDER BY timestamp DESC LIMIT 1"
+	if err := hubDb.Get(&jsonBlob, q); err != nil {
+		slog.Warn("Error fetching", "query", q, "error", err)
+	}
 	// Write the JSON blob to the response
 	w.Write(jsonBlob)
 }
 
 func handleMempoolSize(w http.ResponseWriter, r *http.Request) {
+	period := defaultMempoolSizeRange
+	if v := r.URL.Query().Get("range"); v != "" {
+		var err error
+		if period, err = parseRange(v); err != nil || period <= 0 || period > maxMempoolSizeRange {
+			http.Error(w, fmt.Sprintf("range must be a positive duration up to %dd, got %q",
+				maxMempoolSizeRange/(24*time.Hour), v), http.StatusBadRequest)
+			return
+		}
+	}
+	resolution := r.URL.Query().Get("resolution")
+	if resolution == "" {
+		resolution = defaultResolution(period)
+	}
+	retention, exists := resolutionRetention[resolution]
+	if !exists {
+		http.Error(w, "resolution must be one of raw, hour or day", http.StatusBadRequest)
+		return
+	}
+	// Older history isn't kept at that resolution
+	if period > retention {
+		http.Error(w, fmt.Sprintf("range can't exceed %dd at the %s resolution, got %q",
+			retention/(24*time.Hour), resolution, r.URL.Query().Get("range")), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
 	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite?mode=ro"))
 	defer hubDb.Close()
 
+	since := time.Now().Add(-period)
+	if resolution != ResolutionRaw {
+		rollups, err := getMempoolRollups(hubDb, resolution, since)
+		if err != nil {
+			slog.Warn("Error fetching mempool rollups", "resolution", resolution, "error", err)
+		}
+		if err := json.NewEncoder(w).Encode(rollups); err != nil {
+			slog.Warn("Error encoding JSON", "error", err)
+		}
+		return
+	}
+
 	type SizeSnapshot struct {
 		Timestamp time.Time
 		Count     int
 	}
-	var snapshots []SizeSnapshot
+	snapshots := []SizeSnapshot{}
+	// Without parameters, keep returning the last 60 snapshots
 	q := "SELECT timestamp, count FROM mempool_stats ORDER BY timestamp DESC LIMIT 60"
-	if err := hubDb.Select(&snapshots, q); err != nil {
+	args := []any{}
+	if r.URL.Query().Has("range") || r.URL.Query().Has("resolution") {
+		q = "SELECT timestamp, count FROM mempool_stats WHERE timestamp >= ? ORDER BY timestamp DESC"
+		args = append(args, since.UTC().Format(time.DateTime))
+	}
+	if err := hubDb.Select(&snapshots, q, args...); err != nil {
 		slog.Warn("Error fetching", "query", q, "error", err)
 	}
 	if err := json.NewEncoder(w).Encode(snapshots); err != nil {
@@ -114,6 +816,12 @@ func handleMempoolSize(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleTxDecode(w http.ResponseWriter, r *http.Request) {
+	view := r.URL.Query().Get("view")
+	if err := validView(view); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Read the request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -123,8 +831,8 @@ func handleTxDecode(w http.ResponseWriter, r *http.Request) {
 
 	// Decode the hex-encoded transaction
 	data, err := hex.DecodeString(string(body))
-	var tx codec.Transaction
-	if err := tx.Decode(bytes.NewReader(data)); err != nil {
+	tx, err := decodeRawTx(data)
+	if err != nil {
 		http.Error(w, "Failed to decode transaction", http.StatusBadRequest)
 		return
 	}
@@ -133,13 +841,65 @@ func handleTxDecode(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Encode the decoded transaction as JSON and write to response
-	if err := json.NewEncoder(w).Encode(tx); err != nil {
+	var resp any = tx
+	if view == ViewSummary {
+		resp = summarizeTx(data, &tx)
+	}
+	if r.URL.Query().Get("verify") == "true" {
+		resp = VerifiedTx{Transaction: resp, Verification: verifyTx(data, &tx.Transaction)}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		slog.Warn("Error encoding JSON", "error", err)
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
 }
 
+func handleTxDecodeBatch(w http.ResponseWriter, r *http.Request) {
+	view := r.URL.Query().Get("view")
+	if err := validView(view); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDecodeBatchBytes))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	txs, err := parseTxBatch(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(decodeTxBatch(txs, view, r.URL.Query().Get("verify") == "true")); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleTxEncode(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	tx, err := parseTxJSON(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := encodeTx(tx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, hex.EncodeToString(data))
+}
+
 func handleBlocks(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -149,6 +909,146 @@ func handleBlocks(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// parseBlockCursor parses a BlockPage cursor, or a height alone to start
+// below it
+func parseBlockCursor(cursor string) (int, string, error) {
+	if cursor == "" {
+		return 0, "", nil
+	}
+	heightParam, hash, _ := strings.Cut(cursor, ":")
+	height, err := strconv.Atoi(heightParam)
+	if err != nil || height < 1 {
+		return 0, "", fmt.Errorf("invalid cursor: %q", cursor)
+	}
+	return height, strings.ToLower(hash), nil
+}
+
+func handleBlockPage(w http.ResponseWriter, r *http.Request) {
+	var filter BlockFilter
+	limit, err := intParam(r, "limit", defaultBlockPageSize)
+	if err == nil {
+		filter.CursorHeight, filter.CursorHash, err = parseBlockCursor(r.URL.Query().Get("cursor"))
+	}
+	if err == nil {
+		filter.MinBurnHeight, err = intParam(r, "min_burn_height", 0)
+	}
+	if err == nil {
+		filter.MaxBurnHeight, err = intParam(r, "max_burn_height", 0)
+	}
+	if err == nil && (limit < 1 || limit > maxBlockPageSize) {
+		err = fmt.Errorf("limit must be between 1 and %d, got %d", maxBlockPageSize, limit)
+	}
+	if err == nil && (filter.MinBurnHeight < 0 || filter.MaxBurnHeight < 0) {
+		err = errors.New("burn heights can't be negative")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Tenure = strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("tenure"), "0x"))
+
+	page, err := getBlockPage(filter, limit)
+	if err != nil {
+		slog.Warn("Error fetching blocks", "filter", filter, "error", err)
+		http.Error(w, "Failed to fetch blocks", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleBlockUtilization(w http.ResponseWriter, r *http.Request) {
+	tip, err := blocksTip()
+	if err != nil {
+		slog.Warn("Error fetching blocks tip", "error", err)
+		http.Error(w, "Failed to fetch blocks", http.StatusInternalServerError)
+		return
+	}
+	lowerBound, upperBound, err := heightRange(r, tip, defaultUtilizationBlocks, maxUtilizationBlocks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := getUtilizationSeries(lowerBound, upperBound)
+	if err != nil {
+		slog.Warn("Error fetching block utilization", "from", lowerBound, "to", upperBound, "error", err)
+		http.Error(w, "Failed to fetch blocks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(series); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func writeBlock(w http.ResponseWriter, block BlockHeader, found bool, err error) {
+	if err != nil {
+		slog.Warn("Error fetching block", "error", err)
+		http.Error(w, "Failed to fetch block", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(block); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleBlock(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.Atoi(chi.URLParam(r, "height"))
+	if err != nil || height < 1 {
+		http.Error(w, fmt.Sprintf("invalid block height: %q", chi.URLParam(r, "height")), http.StatusBadRequest)
+		return
+	}
+	block, found, err := getBlock(height, "")
+	writeBlock(w, block, found, err)
+}
+
+func handleBlockTxs(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.Atoi(chi.URLParam(r, "height"))
+	if err != nil || height < 1 {
+		http.Error(w, fmt.Sprintf("invalid block height: %q", chi.URLParam(r, "height")), http.StatusBadRequest)
+		return
+	}
+	block, found, err := getBlock(height, "")
+	if err == nil && !found {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+	var txs BlockTxs
+	if err == nil {
+		txs, found, err = getBlockTxs(block)
+	}
+	if err != nil {
+		slog.Warn("Error fetching block transactions", "height", height, "error", err)
+		http.Error(w, "Failed to fetch block transactions", http.StatusInternalServerError)
+		return
+	}
+	// The node may have the header without the block, e.g. if it was pruned
+	if !found {
+		http.Error(w, "Block body not stored", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(txs); err != nil {
+		slog.Warn("Error encoding JSON", "error", err)
+	}
+}
+
+func handleBlockByHash(w http.ResponseWriter, r *http.Request) {
+	hash := strings.ToLower(strings.TrimPrefix(chi.URLParam(r, "hash"), "0x"))
+	block, found, err := getBlock(0, hash)
+	writeBlock(w, block, found, err)
+}
+
 func service() http.Handler {
 	// Logger
 	logger := httplog.NewLogger("api", httplog.Options{
@@ -172,11 +1072,36 @@ func service() http.Handler {
 
 	// Setup API routes
 	r.Get("/miners/viz", handleMinerViz)
+	r.Get("/miners/viz.svg", handleMinerVizSVG)
+	r.Get("/miners/viz/heights", handleMinerVizHeights)
+	r.Get("/miners/viz/range", handleMinerVizRange)
+	r.Get("/miners/viz/{height}", handleMinerViz)
+	r.Get("/miners/viz/{height}.svg", handleMinerVizSVG)
+	r.Get("/miners/graph", handleMinerGraph)
+	r.Get("/miners/graph/range", handleMinerGraphRange)
+	r.Get("/miners/graph/{height}", handleMinerGraph)
 	r.Get("/miners/power", handleMinerPower)
+	r.Get("/miners/power/history", handleMinerPowerHistory)
+	r.Get("/miners/addresses", handleMinerAddresses)
+	r.Get("/miners/{address}", handleMinerDetail)
+	r.Get("/events/forks", handleForkEvents)
 	r.Get("/mempool/stats", handleMempoolStats)
 	r.Get("/mempool/size", handleMempoolSize)
+	r.Get("/mempool/breakdown", handleMempoolBreakdown)
+	r.Get("/mempool/churn", handleMempoolChurn)
+	r.Get("/mempool/stuck", handleMempoolStuck)
+	r.Get("/mempool/txs", handleMempoolTxs)
+	r.Get("/mempool/tx/{txid}", handleMempoolTx)
+	r.Get("/fees/estimate", handleFeeEstimate)
 	r.Get("/blocks", handleBlocks)
+	r.Get("/blocks/page", handleBlockPage)
+	r.Get("/blocks/utilization", handleBlockUtilization)
+	r.Get("/blocks/{height}", handleBlock)
+	r.Get("/blocks/{height}/txs", handleBlockTxs)
+	r.Get("/blocks/hash/{hash}", handleBlockByHash)
 	r.Post("/tx/decode", handleTxDecode)
+	r.Post("/tx/decode/batch", handleTxDecodeBatch)
+	r.Post("/tx/encode", handleTxEncode)
 
 	return r
 }
@@ -221,6 +1146,16 @@ func main() {
 		log.Fatalf("Error adding task: %v", err)
 	}
 
+	// Add miner power task, runs every two minutes but only records one
+	// snapshot per Bitcoin block
+	if _, err := scheduler.Add(&tasks.Task{
+		Interval: time.Duration(2 * time.Minute),
+		TaskFunc: wrapped("miner power task", minerPowerTask),
+		ErrFunc:  errFunc("minerPowerTask"),
+	}); err != nil {
+		log.Fatalf("Error adding task: %v", err)
+	}
+
 	// Add mempool task, runs every two minutes
 	if _, err := scheduler.Add(&tasks.Task{
 		Interval: time.Duration(2 * time.Minute),
@@ -230,6 +1165,15 @@ func main() {
 		log.Fatalf("Error adding task: %v", err)
 	}
 
+	// Add mempool rollup task, runs every hour
+	if _, err := scheduler.Add(&tasks.Task{
+		Interval: time.Duration(1 * time.Hour),
+		TaskFunc: wrapped("mempool rollup task", mempoolRollupTask),
+		ErrFunc:  errFunc("mempoolRollupTask"),
+	}); err != nil {
+		log.Fatalf("Error adding task: %v", err)
+	}
+
 	// Add CMC task to update STX price, only if CMCKey is non-empty.
 	if config.CMCKey != "" {
 		if _, err := scheduler.Add(&tasks.Task{
@@ -263,8 +1207,21 @@ func main() {
 	if err := updateMinerAddressMapTask(); err != nil {
 		slog.Warn("Error running updateMinerAddressMapTask", "error", err)
 	}
+	// Catch up on the fork events of the blocks mined while we were down,
+	// before the dot task records the new tip
+	if err := backfillForkEvents(); err != nil {
+		slog.Warn("Error backfilling fork events", "error", err)
+	}
 	// Run dot task at startup, ignore errors for now
 	dotsTask()
+	// Record the miner power snapshot for the current Bitcoin block
+	if err := minerPowerTask(); err != nil {
+		slog.Warn("Error running minerPowerTask", "error", err)
+	}
+	// Read the mempool at startup for the mempool endpoints
+	if err := mempoolTask(); err != nil {
+		slog.Warn("Error running mempoolTask", "error", err)
+	}
 	// Let's also prune at startup
 	pruneTask()
 
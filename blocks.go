@@ -0,0 +1,310 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultBlockPageSize = 50
+	maxBlockPageSize     = 500
+)
+
+// BlockHeader is a Nakamoto block header as listed by the /blocks endpoints
+type BlockHeader struct {
+	Block
+	BlockHash           string `db:"block_hash"`
+	IndexBlockHash      string `db:"index_block_hash"`
+	ConsensusHash       string `db:"consensus_hash"`
+	ParentBlockId       string `db:"parent_block_id"`
+	BurnHeaderHash      string `db:"burn_header_hash"`
+	BurnHeaderTimestamp int64  `db:"burn_header_timestamp"`
+	HeightInTenure      int    `db:"height_in_tenure"`
+	// STX address the tenure's rewards are paid to, and its Bitcoin address
+	// if known
+	Miner               string `db:"miner"`
+	MinerBitcoinAddress string
+	// Whether the block is on the canonical chain, rather than a sibling of
+	// a canonical block
+	Canonical bool
+}
+
+// BlockFilter selects the blocks of a page. Zero values don't filter.
+type BlockFilter struct {
+	// Only blocks ordered after the block with this height and index block
+	// hash, see BlockPage
+	CursorHeight  int
+	CursorHash    string
+	MinBurnHeight int
+	MaxBurnHeight int
+	// Consensus hash of the tenure
+	Tenure string
+}
+
+// BlockPage is a page of blocks, highest first, then by index block hash so
+// that sibling blocks are in a stable order. NextCursor is the cursor of the
+// next page, the height and index block hash of the page's last block
+// separated by a colon, or empty on the last page.
+type BlockPage struct {
+	Limit      int
+	NextCursor string
+	Blocks     []BlockHeader
+}
+
+const blockHeaderQuery = `
+	SELECT
+		h.block_size,
+		h.cost,
+		h.total_tenure_cost,
+		h.tenure_changed,
+		h.tenure_tx_fees,
+		h.block_height,
+		h.burn_header_height,
+		h.timestamp,
+		h.block_hash,
+		h.index_block_hash,
+		h.consensus_hash,
+		h.parent_block_id,
+		h.burn_header_hash,
+		h.burn_header_timestamp,
+		h.height_in_tenure,
+		COALESCE((SELECT p.recipient FROM payments p WHERE p.consensus_hash = h.consensus_hash LIMIT 1), '') AS miner
+	FROM nakamoto_block_headers h
+	`
+
+// canonicalChainQuery selects the index block hashes and heights of the
+// canonical chain, from the tip given by its consensus hash and block hash
+// down to the given height
+const canonicalChainQuery = `
+	WITH RECURSIVE canonical(index_block_hash, parent_block_id, block_height) AS (
+		SELECT index_block_hash, parent_block_id, block_height
+		FROM nakamoto_block_headers
+		WHERE consensus_hash = ? AND block_hash = ?
+		UNION ALL
+		SELECT h.index_block_hash, h.parent_block_id, h.block_height
+		FROM nakamoto_block_headers h JOIN canonical c ON h.index_block_hash = c.parent_block_id
+		WHERE c.block_height > ?
+	)
+	SELECT index_block_hash, block_height FROM canonical`
+
+// canonicalTip returns the consensus hash and block hash of the canonical
+// Stacks tip, as of the latest sortition
+func canonicalTip() ([]any, error) {
+	sdb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, sortitionDb))
+	defer sdb.Close()
+
+	var tip struct {
+		ConsensusHash string `db:"canonical_stacks_tip_consensus_hash"`
+		BlockHash     string `db:"canonical_stacks_tip_hash"`
+	}
+	err := sdb.Get(&tip, `SELECT canonical_stacks_tip_consensus_hash, canonical_stacks_tip_hash
+		FROM snapshots WHERE pox_valid = 1 ORDER BY block_height DESC LIMIT 1`)
+	return []any{tip.ConsensusHash, tip.BlockHash}, err
+}
+
+// canonicalBlocks returns the heights of the canonical blocks from the tip
+// down to minHeight, by index block hash
+func canonicalBlocks(db *sqlx.DB, minHeight int) (map[string]int, error) {
+	tip, err := canonicalTip()
+	if err != nil {
+		return nil, err
+	}
+	var chain []struct {
+		IndexBlockHash string `db:"index_block_hash"`
+		BlockHeight    int    `db:"block_height"`
+	}
+	if err := db.Select(&chain, canonicalChainQuery, append(tip, minHeight)...); err != nil {
+		return nil, err
+	}
+	canonical := make(map[string]int, len(chain))
+	for _, block := range chain {
+		canonical[block.IndexBlockHash] = block.BlockHeight
+	}
+	return canonical, nil
+}
+
+// fill computes the block's utilization and fills in the Bitcoin address of
+// its miner
+func (b *BlockHeader) fill() {
+	b.Utilization = blockUtilization(&b.Block)
+	if v, ok := minerAddressMap.Load(b.Miner); ok {
+		b.MinerBitcoinAddress = v.(string)
+	}
+}
+
+// getBlockPage returns up to limit blocks matching filter, highest first
+func getBlockPage(filter BlockFilter, limit int) (BlockPage, error) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, chainstateDb))
+	defer db.Close()
+
+	var conds []string
+	var args []any
+	if filter.CursorHeight > 0 {
+		conds = append(conds, "(h.block_height < ? OR (h.block_height = ? AND h.index_block_hash < ?))")
+		args = append(args, filter.CursorHeight, filter.CursorHeight, filter.CursorHash)
+	}
+	if filter.MinBurnHeight > 0 {
+		conds = append(conds, "h.burn_header_height >= ?")
+		args = append(args, filter.MinBurnHeight)
+	}
+	if filter.MaxBurnHeight > 0 {
+		conds = append(conds, "h.burn_header_height <= ?")
+		args = append(args, filter.MaxBurnHeight)
+	}
+	if filter.Tenure != "" {
+		conds = append(conds, "h.consensus_hash = ?")
+		args = append(args, filter.Tenure)
+	}
+	query := blockHeaderQuery
+	if len(conds) > 0 {
+		query += "WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY h.block_height DESC, h.index_block_hash DESC LIMIT ?"
+	args = append(args, limit)
+
+	page := BlockPage{Limit: limit, Blocks: []BlockHeader{}}
+	if err := db.Select(&page.Blocks, query, args...); err != nil {
+		return page, err
+	}
+	if len(page.Blocks) == 0 {
+		return page, nil
+	}
+	last := page.Blocks[len(page.Blocks)-1]
+	canonical, err := canonicalBlocks(db, last.BlockHeight)
+	if err != nil {
+		return page, err
+	}
+	for i := range page.Blocks {
+		page.Blocks[i].fill()
+		_, page.Blocks[i].Canonical = canonical[page.Blocks[i].IndexBlockHash]
+	}
+	if len(page.Blocks) == limit {
+		page.NextCursor = fmt.Sprintf("%d:%s", last.BlockHeight, last.IndexBlockHash)
+	}
+	return page, nil
+}
+
+// getBlock returns the canonical block with the given height, or the block
+// with the given index block hash if height is 0. The second return value is
+// false if there is no such block.
+func getBlock(height int, indexBlockHash string) (BlockHeader, bool, error) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, chainstateDb))
+	defer db.Close()
+
+	var block BlockHeader
+	if height > 0 {
+		canonical, err := canonicalBlocks(db, height)
+		if err != nil {
+			return block, true, err
+		}
+		indexBlockHash = ""
+		for hash, h := range canonical {
+			if h == height {
+				indexBlockHash = hash
+			}
+		}
+	}
+	err := db.Get(&block, blockHeaderQuery+"WHERE h.index_block_hash = ?", indexBlockHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return block, false, nil
+	}
+	if err != nil {
+		return block, true, err
+	}
+	block.fill()
+	block.Canonical = height > 0
+	if !block.Canonical {
+		canonical, err := canonicalBlocks(db, block.BlockHeight)
+		if err != nil {
+			return block, true, err
+		}
+		_, block.Canonical = canonical[block.IndexBlockHash]
+	}
+	return block, true, nil
+}
+
+// BlockTx is a transaction of a block as listed by /blocks/{height}/txs.
+// Error is set if the codec failed to decode it, leaving only its txid and
+// length. FunctionArgsError is set if its contract call arguments failed to
+// decode.
+type BlockTx struct {
+	Txid        string
+	PayloadType string
+	Sender      string
+	Sponsor     string
+	Nonce       uint64
+	// Fee paid by the sponsor if sponsored
+	Fee               uint64
+	Length            int
+	Contract          string
+	Function          string
+	FunctionArgs      []ClarityValue
+	FunctionArgsError string
+	Error             string
+}
+
+type BlockTxs struct {
+	Block        BlockHeader
+	Transactions []BlockTx
+}
+
+// readBlockData returns the serialized Nakamoto block with the given index
+// block hash. The second return value is false if it isn't stored.
+func readBlockData(indexBlockHash string) ([]byte, bool, error) {
+	bdb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, nakamotoBlocksDb))
+	defer bdb.Close()
+
+	var data []byte
+	err := bdb.Get(&data, "SELECT data FROM nakamoto_staging_blocks WHERE index_block_hash = ? LIMIT 1",
+		indexBlockHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+// newBlockTx decodes raw, a transaction of a block
+func newBlockTx(raw []byte) BlockTx {
+	btx := BlockTx{Txid: txid(raw), Length: len(raw)}
+	tx, err := decodeRawTx(raw)
+	if err != nil {
+		btx.Error = err.Error()
+		return btx
+	}
+	btx.PayloadType = tx.Payload.Type.String()
+	btx.Sender = txSender(&tx.Transaction)
+	btx.Sponsor = txSponsor(&tx.Transaction)
+	btx.Nonce = tx.Authorization.OriginCondition.Nonce
+	btx.Fee = tx.Authorization.OriginCondition.Fee
+	if tx.Authorization.SponsorCondition != nil {
+		btx.Fee = tx.Authorization.SponsorCondition.Fee
+	}
+	btx.Contract = txContract(&tx.Transaction)
+	btx.Function = txFunction(&tx.Transaction)
+	btx.FunctionArgs = tx.FunctionArgs
+	btx.FunctionArgsError = tx.FunctionArgsError
+	return btx
+}
+
+// getBlockTxs decodes the transactions of block, in block order. The second
+// return value is false if the block's body isn't stored.
+func getBlockTxs(block BlockHeader) (BlockTxs, bool, error) {
+	txs := BlockTxs{Block: block, Transactions: []BlockTx{}}
+	data, found, err := readBlockData(block.IndexBlockHash)
+	if !found || err != nil {
+		return txs, found, err
+	}
+	parsed, err := parseNakamotoBlock(data)
+	if err != nil {
+		return txs, true, err
+	}
+	for _, raw := range parsed.Txs {
+		txs.Transactions = append(txs.Transactions, newBlockTx(raw))
+	}
+	return txs, true, nil
+}
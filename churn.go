@@ -0,0 +1,237 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	ExitConfirmed = "confirmed"
+	ExitEvicted   = "evicted"
+
+	defaultChurnHours = 24
+	// mempool_txs exits are pruned after 2 days
+	maxChurnHours = 48
+)
+
+// Lower bounds of the fee rate buckets confirmation latency is reported by,
+// in uSTX per byte
+var churnFeeRateBuckets = []float64{0, 10, 50, 100, 250, 500, 1000, 2500}
+
+// minedTx is where and when a transaction was confirmed
+type minedTx struct {
+	BlockHeight int
+	Time        int64
+}
+
+// minedTxs returns the transactions of the Nakamoto blocks processed at or
+// after since, a Unix timestamp, keyed by txid.
+func minedTxs(since int64) (map[string]minedTx, error) {
+	bdb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, nakamotoBlocksDb))
+	defer bdb.Close()
+
+	const query = `
+	SELECT height, processed_time, data
+	FROM nakamoto_staging_blocks
+	WHERE processed = 1 AND orphaned = 0 AND processed_time >= ?
+	`
+	rows, err := bdb.Queryx(query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mined := make(map[string]minedTx)
+	for rows.Next() {
+		var height int
+		var processed int64
+		var data []byte
+		if err := rows.Scan(&height, &processed, &data); err != nil {
+			return nil, err
+		}
+		block, err := parseNakamotoBlock(data)
+		if err != nil {
+			slog.Warn("Error parsing Nakamoto block", "height", height, "error", err)
+			continue
+		}
+		for _, raw := range block.Txs {
+			mined[txid(raw)] = minedTx{height, processed}
+		}
+	}
+	return mined, rows.Err()
+}
+
+// trackMempoolChurn records the arrival of transactions not seen by previous
+// runs, and the exit of the ones that were mined since or are no longer in
+// the mempool. Evicted transactions that reappear are tracked again. readAt
+// is when mempool was read.
+func trackMempoolChurn(hubDb *sqlx.DB, mempool []mempoolTxn, readAt int64) error {
+	// Blocks processed since exits were last classified may have confirmed
+	// anything we were tracking. Before the first classification, that's
+	// since the last time a transaction was seen.
+	var classifiedThrough *int64
+	if err := hubDb.Get(&classifiedThrough, `SELECT COALESCE(
+		(SELECT classified_through FROM mempool_churn),
+		(SELECT MAX(last_seen) FROM mempool_txs))`); err != nil {
+		return err
+	}
+
+	tx := hubDb.MustBegin()
+	defer tx.Rollback()
+
+	for _, txn := range mempool {
+		_, err := tx.Exec(`
+		INSERT INTO mempool_txs (txid, fee_rate, arrival, last_seen) VALUES (?, ?, ?, ?)
+		ON CONFLICT (txid) DO UPDATE SET last_seen = excluded.last_seen, exit = NULL, exit_type = NULL
+		WHERE exit_type IS NOT ?`,
+			txn.Txid, txn.FeeRate(), readAt-int64(txn.Age), readAt, ExitConfirmed)
+		if err != nil {
+			return err
+		}
+	}
+
+	if classifiedThrough != nil {
+		// Blocks processed after readAt are included, and looked at again by
+		// the next run
+		mined, err := minedTxs(*classifiedThrough)
+		if err != nil {
+			// Keep the arrivals. Exits are left unclassified, for the next
+			// run to look at the blocks from classifiedThrough again.
+			if err := tx.Commit(); err != nil {
+				slog.Warn("Error recording mempool arrivals", "error", err)
+			}
+			return err
+		}
+		for id, m := range mined {
+			_, err := tx.Exec(
+				"UPDATE mempool_txs SET exit = ?, exit_type = ?, block_height = ? WHERE txid = ? AND exit IS NULL",
+				m.Time, ExitConfirmed, m.BlockHeight, id)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec("UPDATE mempool_txs SET exit = ?, exit_type = ? WHERE exit IS NULL AND last_seen < ?",
+			readAt, ExitEvicted, readAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`INSERT INTO mempool_churn (id, classified_through) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET classified_through = excluded.classified_through`, readAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// confirmedTxids returns the tracked transactions that were mined
+func confirmedTxids(hubDb *sqlx.DB) (map[string]bool, error) {
+	var txids []string
+	if err := hubDb.Select(&txids, "SELECT txid FROM mempool_txs WHERE exit_type = ?", ExitConfirmed); err != nil {
+		return nil, err
+	}
+	confirmed := make(map[string]bool, len(txids))
+	for _, id := range txids {
+		confirmed[id] = true
+	}
+	return confirmed, nil
+}
+
+// feeRateBucket returns the index of the fee rate bucket rate falls in
+func feeRateBucket(rate float64) int {
+	i, found := slices.BinarySearch(churnFeeRateBuckets, rate)
+	if found {
+		return i
+	}
+	return max(0, i-1)
+}
+
+// LatencyBucket holds the time in mempool of the transactions that left it,
+// for a range of fee rates. Latencies are those of confirmed transactions, in
+// seconds.
+type LatencyBucket struct {
+	MinFeeRate float64
+	// 0 for the last, unbounded bucket
+	MaxFeeRate float64
+	Confirmed  int
+	Evicted    int
+	Mean       float64
+	Median     float64
+	P90        float64
+	Max        float64
+}
+
+type MempoolChurn struct {
+	Since     time.Time
+	Arrivals  int
+	Confirmed int
+	Evicted   int
+	Pending   int
+	Latency   []LatencyBucket
+}
+
+// getMempoolChurn summarizes the mempool arrivals and exits since the Unix
+// timestamp since.
+func getMempoolChurn(hubDb *sqlx.DB, since int64) (MempoolChurn, error) {
+	c := MempoolChurn{Since: time.Unix(since, 0).UTC()}
+	err := hubDb.Get(&c, `
+	SELECT
+		COALESCE(SUM(arrival >= ?), 0) AS arrivals,
+		COALESCE(SUM(exit >= ? AND exit_type = ?), 0) AS confirmed,
+		COALESCE(SUM(exit >= ? AND exit_type = ?), 0) AS evicted,
+		COALESCE(SUM(exit IS NULL), 0) AS pending
+	FROM mempool_txs`, since, since, ExitConfirmed, since, ExitEvicted)
+	if err != nil {
+		return c, err
+	}
+
+	var exits []struct {
+		FeeRate  float64 `db:"fee_rate"`
+		ExitType string  `db:"exit_type"`
+		Latency  float64 `db:"latency"`
+	}
+	err = hubDb.Select(&exits,
+		"SELECT fee_rate, exit_type, MAX(exit - arrival, 0) AS latency FROM mempool_txs WHERE exit >= ?",
+		since)
+	if err != nil {
+		return c, err
+	}
+
+	latencies := make([][]float64, len(churnFeeRateBuckets))
+	c.Latency = make([]LatencyBucket, len(churnFeeRateBuckets))
+	for i, lower := range churnFeeRateBuckets {
+		c.Latency[i].MinFeeRate = lower
+		if i+1 < len(churnFeeRateBuckets) {
+			c.Latency[i].MaxFeeRate = churnFeeRateBuckets[i+1]
+		}
+	}
+	for _, e := range exits {
+		i := feeRateBucket(e.FeeRate)
+		if e.ExitType == ExitEvicted {
+			c.Latency[i].Evicted += 1
+			continue
+		}
+		c.Latency[i].Confirmed += 1
+		latencies[i] = append(latencies[i], e.Latency)
+	}
+	for i, l := range latencies {
+		if len(l) == 0 {
+			continue
+		}
+		slices.Sort(l)
+		var total float64
+		for _, v := range l {
+			total += v
+		}
+		c.Latency[i].Mean = total / float64(len(l))
+		c.Latency[i].Median = quantile(l, 0.5)
+		c.Latency[i].P90 = quantile(l, 0.9)
+		c.Latency[i].Max = l[len(l)-1]
+	}
+	return c, nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stxpub/codec"
+)
+
+// Clarity values are decoded here rather than by the codec, which doesn't
+// read contract call arguments and misreads some types.
+
+// Clarity limits values to 32 levels of nesting
+const maxClarityDepth = 32
+
+// ClarityValue is a decoded Clarity value. Type is its Clarity type: int,
+// uint, buff, bool, principal, ok, err, none, some, list, tuple, string-ascii
+// or string-utf8. Value depends on Type:
+//   - int and uint: the decimal number, as a string
+//   - buff: 0x prefixed hex
+//   - bool: a boolean
+//   - principal: the address, followed by the contract name for contracts
+//   - ok, err and some: the inner ClarityValue
+//   - none: null
+//   - list: an array of ClarityValue
+//   - tuple: an object of ClarityValue by key
+//   - string-ascii and string-utf8: the string
+//
+// Repr is the value as a Clarity literal, such as (some u1).
+type ClarityValue struct {
+	Type  string
+	Value any
+	Repr  string
+}
+
+// readClarityPrefixed reads a byte string prefixed by its length, as a big
+// endian integer of lenSize bytes.
+func readClarityPrefixed(r *bytes.Reader, lenSize int) ([]byte, error) {
+	var n int
+	switch lenSize {
+	case 1:
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n = int(b)
+	case 4:
+		var l uint32
+		if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+			return nil, err
+		}
+		if int64(l) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n = int(l)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readClarityPrincipal reads a standard principal, or a contract principal
+// if contract is set
+func readClarityPrincipal(r *bytes.Reader, contract bool) (string, error) {
+	var addr codec.Address
+	version, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	addr.Version = codec.AddressVersion(version)
+	if _, err := io.ReadFull(r, addr.HashBytes[:]); err != nil {
+		return "", err
+	}
+	principal := addr.ToStacks()
+	if contract {
+		name, err := readClarityPrefixed(r, 1)
+		if err != nil {
+			return "", err
+		}
+		principal += "." + string(name)
+	}
+	return principal, nil
+}
+
+// clarityString renders s as a Clarity string literal. Only UTF-8 strings
+// have an escape for any character, \u{..}, so characters outside of
+// printable ASCII are only escaped in those. ASCII strings can only hold the
+// characters validClarityASCII accepts.
+func clarityString(s string, utf8String bool) string {
+	var b strings.Builder
+	if utf8String {
+		b.WriteString("u")
+	}
+	b.WriteString(`"`)
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == 0:
+			b.WriteString(`\0`)
+		case utf8String && (c < 0x20 || c >= 0x7f):
+			fmt.Fprintf(&b, `\u{%x}`, c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteString(`"`)
+	return b.String()
+}
+
+// validClarityASCII reports whether b only has the characters stacks-core
+// accepts in ASCII strings: printable ASCII and whitespace.
+func validClarityASCII(b []byte) bool {
+	for _, c := range b {
+		if (c < 0x20 || c > 0x7e) && c != '\t' && c != '\n' && c != '\f' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeClarityValue decodes a consensus serialized Clarity value
+func decodeClarityValue(r *bytes.Reader) (ClarityValue, error) {
+	return decodeClarityValueDepth(r, 0)
+}
+
+func decodeClarityValueDepth(r *bytes.Reader, depth int) (ClarityValue, error) {
+	var v ClarityValue
+	if depth > maxClarityDepth {
+		return v, errors.New("clarity value nested too deeply")
+	}
+	typeID, err := r.ReadByte()
+	if err != nil {
+		return v, err
+	}
+
+	switch typeID {
+	case 0x00, 0x01:
+		b := make([]byte, 16)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return v, err
+		}
+		n := new(big.Int).SetBytes(b)
+		if typeID == 0x00 {
+			v.Type = "int"
+			// two's complement
+			if b[0]&0x80 != 0 {
+				n.Sub(n, new(big.Int).Lsh(big.NewInt(1), 128))
+			}
+			v.Repr = n.String()
+		} else {
+			v.Type = "uint"
+			v.Repr = "u" + n.String()
+		}
+		v.Value = n.String()
+
+	case 0x02:
+		b, err := readClarityPrefixed(r, 4)
+		if err != nil {
+			return v, err
+		}
+		v.Type = "buff"
+		v.Value = "0x" + hex.EncodeToString(b)
+		v.Repr = v.Value.(string)
+
+	case 0x03, 0x04:
+		v.Type = "bool"
+		v.Value = typeID == 0x03
+		v.Repr = fmt.Sprint(v.Value)
+
+	case 0x05, 0x06:
+		principal, err := readClarityPrincipal(r, typeID == 0x06)
+		if err != nil {
+			return v, err
+		}
+		v.Type = "principal"
+		v.Value = principal
+		v.Repr = "'" + principal
+
+	case 0x07, 0x08, 0x0a:
+		inner, err := decodeClarityValueDepth(r, depth+1)
+		if err != nil {
+			return v, err
+		}
+		v.Type = map[byte]string{0x07: "ok", 0x08: "err", 0x0a: "some"}[typeID]
+		v.Value = inner
+		v.Repr = fmt.Sprintf("(%s %s)", v.Type, inner.Repr)
+
+	case 0x09:
+		v.Type = "none"
+		v.Repr = "none"
+
+	case 0x0b:
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return v, err
+		}
+		items := []ClarityValue{}
+		reprs := []string{"list"}
+		for i := uint32(0); i < n; i++ {
+			item, err := decodeClarityValueDepth(r, depth+1)
+			if err != nil {
+				return v, err
+			}
+			items = append(items, item)
+			reprs = append(reprs, item.Repr)
+		}
+		v.Type = "list"
+		v.Value = items
+		v.Repr = "(" + strings.Join(reprs, " ") + ")"
+
+	case 0x0c:
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return v, err
+		}
+		fields := make(map[string]ClarityValue)
+		reprs := []string{"tuple"}
+		for i := uint32(0); i < n; i++ {
+			name, err := readClarityPrefixed(r, 1)
+			if err != nil {
+				return v, err
+			}
+			field, err := decodeClarityValueDepth(r, depth+1)
+			if err != nil {
+				return v, err
+			}
+			fields[string(name)] = field
+			reprs = append(reprs, fmt.Sprintf("(%s %s)", name, field.Repr))
+		}
+		v.Type = "tuple"
+		v.Value = fields
+		v.Repr = "(" + strings.Join(reprs, " ") + ")"
+
+	case 0x0d, 0x0e:
+		b, err := readClarityPrefixed(r, 4)
+		if err != nil {
+			return v, err
+		}
+		if typeID == 0x0d {
+			v.Type = "string-ascii"
+			if !validClarityASCII(b) {
+				return v, errors.New("invalid string-ascii character")
+			}
+		} else {
+			v.Type = "string-utf8"
+			if !utf8.Valid(b) {
+				return v, errors.New("invalid string-utf8 encoding")
+			}
+		}
+		v.Value = string(b)
+		v.Repr = clarityString(string(b), typeID == 0x0e)
+
+	default:
+		return v, fmt.Errorf("unknown clarity type %#x", typeID)
+	}
+	return v, nil
+}
+
+// contractCallArgs decodes the function arguments of raw, a serialized
+// contract call
+func contractCallArgs(raw []byte) ([]ClarityValue, error) {
+	r := bytes.NewReader(raw)
+	if err := skipToPayload(r); err != nil {
+		return nil, err
+	}
+	payloadType, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if payloadType != byte(codec.ContractCall) {
+		return nil, fmt.Errorf("not a contract call: payload type %#x", payloadType)
+	}
+	// contract address, contract name and function name
+	if err := skipBytes(r, 21); err != nil {
+		return nil, err
+	}
+	if err := skipPrefixed(r, 1); err != nil {
+		return nil, err
+	}
+	if err := skipPrefixed(r, 1); err != nil {
+		return nil, err
+	}
+
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	args := []ClarityValue{}
+	for i := uint32(0); i < n; i++ {
+		arg, err := decodeClarityValue(r)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// clarityReprs returns the Clarity literals of values
+func clarityReprs(values []ClarityValue) []string {
+	reprs := make([]string, len(values))
+	for i, v := range values {
+		reprs[i] = v.Repr
+	}
+	return reprs
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestDecodeClarityValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		hex     string
+		typ     string
+		repr    string
+		invalid bool
+	}{
+		{"int", "00000000000000000000000000000000" + "2a", "int", "42", false},
+		{"negative int", "00" + "ffffffffffffffffffffffffffffffd6", "int", "-42", false},
+		{"min int", "00" + "80000000000000000000000000000000", "int", "-170141183460469231731687303715884105728", false},
+		{"uint", "01" + "000000000000000000000000000000ff", "uint", "u255", false},
+		{"buff", "02" + "00000002" + "beef", "buff", "0xbeef", false},
+		{"true", "03", "bool", "true", false},
+		{"false", "04", "bool", "false", false},
+		{"standard principal", "05" + "16" + strings.Repeat("00", 20), "principal", "'SP000000000000000000002Q6VF78", false},
+		{"contract principal", "06" + "16" + strings.Repeat("00", 20) + "03" + "706f78", "principal",
+			"'SP000000000000000000002Q6VF78.pox", false},
+		{"ok", "07" + "03", "ok", "(ok true)", false},
+		{"err", "08" + "01" + "00000000000000000000000000000001", "err", "(err u1)", false},
+		{"none", "09", "none", "none", false},
+		{"nested optionals", "0a" + "0a" + "09", "some", "(some (some none))", false},
+		{"nested responses", "07" + "08" + "0a" + "04", "ok", "(ok (err (some false)))", false},
+		{"list", "0b" + "00000002" + "03" + "04", "list", "(list true false)", false},
+		{"empty list", "0b" + "00000000", "list", "(list)", false},
+		{"nested tuples", "0c" + "00000002" + "0161" + "03" + "0162" + "0c" + "00000001" + "0163" + "09",
+			"tuple", "(tuple (a true) (b (tuple (c none))))", false},
+		{"string-ascii", "0d" + "00000002" + "6869", "string-ascii", `"hi"`, false},
+		{"string-ascii escapes", "0d" + "00000007" + "22" + "5c" + "0a" + "09" + "0d" + "0c" + "7e", "string-ascii",
+			"\"\\\"\\\\\\n\\t\\r\f~\"", false},
+		{"string-ascii control character", "0d" + "00000001" + "01", "", "", true},
+		{"string-ascii non-ASCII", "0d" + "00000001" + "80", "", "", true},
+		{"string-utf8", "0e" + "00000003" + "e282ac", "string-utf8", `u"\u{20ac}"`, false},
+		{"string-utf8 escapes", "0e" + "00000004" + "22" + "00" + "01" + "7f", "string-utf8", `u"\"\0\u{1}\u{7f}"`, false},
+		{"string-utf8 invalid", "0e" + "00000001" + "ff", "", "", true},
+		{"unknown type", "0f", "", "", true},
+		{"empty", "", "", "", true},
+		{"truncated int", "01" + "0000", "", "", true},
+		{"truncated buff length", "02" + "0000", "", "", true},
+		{"buff longer than input", "02" + "00000010" + "beef", "", "", true},
+		{"truncated list", "0b" + "00000002" + "03", "", "", true},
+		{"truncated tuple key", "0c" + "00000001" + "05" + "61", "", "", true},
+		{"truncated principal", "05" + "16" + "0000", "", "", true},
+		{"depth limit", strings.Repeat("0a", maxClarityDepth) + "09", "some", "", false},
+		{"too deep", strings.Repeat("0a", maxClarityDepth+1) + "09", "", "", true},
+		{"too deep list", strings.Repeat("0b00000001", maxClarityDepth+1) + "09", "", "", true},
+	}
+	for _, tt := range tests {
+		data, err := hex.DecodeString(tt.hex)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		v, err := decodeClarityValue(bytes.NewReader(data))
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("%s: decoded %s, want an error", tt.name, v.Repr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if v.Type != tt.typ || (tt.repr != "" && v.Repr != tt.repr) {
+			t.Errorf("%s: got %s %s, want %s %s", tt.name, v.Type, v.Repr, tt.typ, tt.repr)
+		}
+	}
+}
+
+func TestDecodeClarityValueJSON(t *testing.T) {
+	data, _ := hex.DecodeString("07" + "0a" + "00" + "fffffffffffffffffffffffffffffffe")
+	v, err := decodeClarityValue(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	some, ok := v.Value.(ClarityValue)
+	if !ok || some.Type != "some" {
+		t.Fatalf("ok value = %#v, want some", v.Value)
+	}
+	n, ok := some.Value.(ClarityValue)
+	if !ok || n.Type != "int" || n.Value != "-2" {
+		t.Errorf("some value = %#v, want int -2", some.Value)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -16,6 +17,8 @@ const (
 	sortitionDb  = "burnchain/sortition/marf.sqlite?mode=ro"
 	chainstateDb = "chainstate/vm/index.sqlite?mode=ro"
 	mempoolDb    = "chainstate/mempool.sqlite?mode=ro"
+	// Nakamoto blocks, only used for their transactions
+	nakamotoBlocksDb = "chainstate/blocks/nakamoto.sqlite?mode=ro"
 
 	dotsSchema = `
 	CREATE TABLE IF NOT EXISTS dots (
@@ -25,6 +28,27 @@ const (
 	dot TEXT NOT NULL
 	);`
 
+	graphsSchema = `
+	CREATE TABLE IF NOT EXISTS graphs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+	bitcoin_block_height INTEGER,
+	data JSONB
+	);`
+
+	forkEventsSchema = `
+	CREATE TABLE IF NOT EXISTS fork_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+	bitcoin_block_height INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	txid TEXT NOT NULL DEFAULT '',
+	sender TEXT,
+	parent TEXT,
+	details TEXT,
+	UNIQUE (type, bitcoin_block_height, txid)
+	);`
+
 	mempoolStatsSchema = `
 	CREATE TABLE IF NOT EXISTS mempool_stats (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -33,6 +57,70 @@ const (
 	data JSONB
 	);`
 
+	// timestamp is the start of the hour or day summarized
+	mempoolRollupsSchema = `
+	CREATE TABLE IF NOT EXISTS mempool_rollups (
+	resolution TEXT NOT NULL,
+	timestamp DATETIME NOT NULL,
+	samples INTEGER,
+	min_count INTEGER,
+	max_count INTEGER,
+	avg_count REAL,
+	fee_rate_low REAL,
+	fee_rate_medium REAL,
+	fee_rate_high REAL,
+	PRIMARY KEY (resolution, timestamp)
+	);`
+
+	// Times are Unix timestamps. exit is set once the transaction was mined,
+	// see exit_type, or dropped from the mempool. mempool_churn has a single
+	// row, with the time up to which exits were classified.
+	mempoolTxsSchema = `
+	CREATE TABLE IF NOT EXISTS mempool_txs (
+	txid TEXT PRIMARY KEY,
+	fee_rate REAL NOT NULL,
+	arrival INTEGER NOT NULL,
+	last_seen INTEGER NOT NULL,
+	exit INTEGER,
+	exit_type TEXT,
+	block_height INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS mempool_txs_exit ON mempool_txs (exit);
+	CREATE TABLE IF NOT EXISTS mempool_churn (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	classified_through INTEGER NOT NULL
+	);`
+
+	minerPowerSchema = `
+	CREATE TABLE IF NOT EXISTS miner_power (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+	bitcoin_block_height INTEGER,
+	stacks_recipient TEXT NOT NULL,
+	bitcoin_address TEXT,
+	blocks_won INTEGER,
+	btc_spent INTEGER,
+	stx_earnt REAL,
+	win_rate REAL
+	);
+	CREATE INDEX IF NOT EXISTS miner_power_height ON miner_power (bitcoin_block_height);`
+
+	minerAddressesSchema = `
+	CREATE TABLE IF NOT EXISTS miner_addresses (
+	stacks_recipient TEXT NOT NULL,
+	bitcoin_address TEXT NOT NULL,
+	first_seen INTEGER,
+	last_seen INTEGER,
+	PRIMARY KEY (stacks_recipient, bitcoin_address)
+	);`
+
+	feeEstimatesSchema = `
+	CREATE TABLE IF NOT EXISTS fee_estimates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+	data JSONB
+	);`
+
 	stxPriceSchema = `
 	CREATE TABLE IF NOT EXISTS sats_per_stx (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -58,6 +146,8 @@ type Block struct {
 	BlockHeight      int        `db:"block_height"`
 	BurnHeaderHeight int        `db:"burn_header_height"`
 	Timestamp        int64      `db:"timestamp"`
+	// Computed from the costs and size
+	Utilization BlockUtilization `db:"-"`
 }
 
 // Scan implements the sql.Scanner interface for CostVector
@@ -94,7 +184,14 @@ func createTables(dbPath string) {
 
 	tx := db.MustBegin()
 	db.MustExec(dotsSchema)
+	db.MustExec(graphsSchema)
+	db.MustExec(forkEventsSchema)
 	db.MustExec(mempoolStatsSchema)
+	db.MustExec(mempoolTxsSchema)
+	db.MustExec(mempoolRollupsSchema)
+	db.MustExec(feeEstimatesSchema)
+	db.MustExec(minerPowerSchema)
+	db.MustExec(minerAddressesSchema)
 	db.MustExec(stxPriceSchema)
 	tx.Commit()
 }
@@ -131,12 +228,88 @@ func getBlocks() []Block {
 		slog.Error("Error fetching blocks", "error", err)
 		return nil
 	}
+	for i := range blocks {
+		blocks[i].Utilization = blockUtilization(&blocks[i])
+	}
 	return blocks
 }
 
+// MinerPowerPoint is one miner's power as recorded at a Bitcoin block
+type MinerPowerPoint struct {
+	BitcoinBlockHeight int       `db:"bitcoin_block_height"`
+	Timestamp          time.Time `db:"timestamp"`
+	BitcoinAddress     string    `db:"bitcoin_address"`
+	BlocksWon          uint      `db:"blocks_won"`
+	BtcSpent           uint      `db:"btc_spent"`
+	StxEarnt           float32   `db:"stx_earnt"`
+	WinRate            float32   `db:"win_rate"`
+}
+
+// getMinerPowerHistory returns the recorded miner power snapshots for the
+// Bitcoin blocks in (lowerBound, upperBound], keyed by Stacks recipient and
+// ordered by height.
+func getMinerPowerHistory(hubDb *sqlx.DB, lowerBound, upperBound int) map[string][]MinerPowerPoint {
+	const query = `
+	SELECT
+		stacks_recipient,
+		bitcoin_block_height,
+		timestamp,
+		COALESCE(bitcoin_address, '') AS bitcoin_address,
+		blocks_won,
+		btc_spent,
+		stx_earnt,
+		win_rate
+	FROM miner_power
+	WHERE bitcoin_block_height > ? AND bitcoin_block_height <= ?
+	ORDER BY bitcoin_block_height ASC
+	`
+	var rows []struct {
+		StacksRecipient string `db:"stacks_recipient"`
+		MinerPowerPoint
+	}
+	if err := hubDb.Select(&rows, query, lowerBound, upperBound); err != nil {
+		slog.Warn("Error fetching miner power history", "error", err)
+		return nil
+	}
+
+	history := make(map[string][]MinerPowerPoint)
+	for _, row := range rows {
+		history[row.StacksRecipient] = append(history[row.StacksRecipient], row.MinerPowerPoint)
+	}
+	return history
+}
+
+// MinerAddress maps a miner's STX payout address to a Bitcoin address it
+// committed from, with the burn heights at which the pair was first and last
+// seen winning a sortition.
+type MinerAddress struct {
+	StacksRecipient string `db:"stacks_recipient"`
+	BitcoinAddress  string `db:"bitcoin_address"`
+	FirstSeen       int    `db:"first_seen"`
+	LastSeen        int    `db:"last_seen"`
+}
+
+// updateMinerAddressMapTask records the STX and Bitcoin addresses of recent
+// sortition winners in hub.sqlite, then reloads the in-memory maps from there.
 func updateMinerAddressMapTask() error {
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite"))
+	defer hubDb.Close()
+
+	err := recordMinerAddresses(hubDb)
+	if err != nil {
+		slog.Warn("Error recording miner addresses", "error", err)
+	}
+	// Load even if recording failed, so that a restart still has the
+	// previously seen addresses
+	if err := loadMinerAddressMap(hubDb); err != nil {
+		return err
+	}
+	return err
+}
+
+func recordMinerAddresses(hubDb *sqlx.DB) error {
 	query := `SELECT
-		payments.recipient,marf.block_commits.apparent_sender
+		payments.recipient,marf.block_commits.apparent_sender,nakamoto_block_headers.burn_header_height
 	FROM payments
 	LEFT JOIN nakamoto_block_headers
 		ON payments.index_block_hash = nakamoto_block_headers.index_block_hash
@@ -144,38 +317,90 @@ func updateMinerAddressMapTask() error {
 		ON nakamoto_block_headers.consensus_hash = marf.snapshots.consensus_hash
 	LEFT JOIN marf.block_commits
 		ON marf.snapshots.winning_block_txid = marf.block_commits.txid
+	-- Pre-Nakamoto payments have no Nakamoto header to get a sender from
+	WHERE nakamoto_block_headers.burn_header_height IS NOT NULL
+		AND marf.block_commits.apparent_sender IS NOT NULL
 	ORDER BY payments.stacks_block_height DESC
 	LIMIT ?`
 
+	// Only look at the last day of payments, unless this is the first run
+	// and we need to backfill. A negative LIMIT is no limit in sqlite.
+	limit := 144
+	var known int
+	if err := hubDb.Get(&known, "SELECT COUNT(*) FROM miner_addresses"); err != nil {
+		return err
+	}
+	if known == 0 {
+		limit = -1
+	}
+
 	dbPath := filepath.Join(config.DataDir, chainstateDb)
 	cdb := sqlx.MustOpen("sqlite3", dbPath)
 	defer cdb.Close()
 
 	dbPath = filepath.Join(config.DataDir, sortitionDb)
 	cdb.MustExec(fmt.Sprintf("ATTACH DATABASE 'file:%s' AS marf", dbPath))
-	rows, err := cdb.Query(query, 144)
+	rows, err := cdb.Query(query, limit)
 	if err != nil {
 		slog.Warn("Error query miner addresses", "query", query, "error", err)
 		return err
 	}
 	defer rows.Close()
 
-	// Clear the existing map
-	minerAddressMap.Clear()
+	tx, err := hubDb.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
 	var stxAddr, btcAddr string
+	var burnHeight int
 	for rows.Next() {
-		if err := rows.Scan(&stxAddr, &btcAddr); err != nil {
+		if err := rows.Scan(&stxAddr, &btcAddr, &burnHeight); err != nil {
 			slog.Warn("Error scanning miner addresses", "error", err)
 			continue
 		}
 		btcAddr = strings.Trim(btcAddr, "\"")
-		// Don't overwrite
-		slog.Debug("Trying to add mapping", "stx", stxAddr, "btc", btcAddr)
-		if old, exists := minerAddressMap.LoadOrStore(stxAddr, btcAddr); exists {
-			slog.Debug("Skipping mapping", "stx", stxAddr, "old", old, "new", btcAddr)
+		slog.Debug("Recording mapping", "stx", stxAddr, "btc", btcAddr, "burnHeight", burnHeight)
+		if _, err := tx.Exec(`INSERT INTO miner_addresses
+			(stacks_recipient, bitcoin_address, first_seen, last_seen) VALUES (?, ?, ?, ?)
+			ON CONFLICT (stacks_recipient, bitcoin_address) DO UPDATE SET
+				first_seen = MIN(first_seen, excluded.first_seen),
+				last_seen = MAX(last_seen, excluded.last_seen)`,
+			stxAddr, btcAddr, burnHeight, burnHeight); err != nil {
+			return err
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// minerBitcoinAddresses returns every Bitcoin address seen paying out to
+// stxAddr, most recently seen first
+func minerBitcoinAddresses(hubDb *sqlx.DB, stxAddr string) ([]string, error) {
+	addresses := []string{}
+	err := hubDb.Select(&addresses, `SELECT bitcoin_address FROM miner_addresses
+		WHERE stacks_recipient = ? ORDER BY last_seen DESC`, stxAddr)
+	return addresses, err
+}
+
+func loadMinerAddressMap(hubDb *sqlx.DB) error {
+	var addresses []MinerAddress
+	// Oldest first, so that the most recently seen Bitcoin address wins
+	if err := hubDb.Select(&addresses, `SELECT stacks_recipient, bitcoin_address, first_seen, last_seen
+		FROM miner_addresses ORDER BY last_seen ASC`); err != nil {
+		return err
+	}
+
+	// Clear the existing maps
+	minerAddressMap.Clear()
+	minerSenderMap.Clear()
+	for _, a := range addresses {
+		minerAddressMap.Store(a.StacksRecipient, a.BitcoinAddress)
+		minerSenderMap.Store(a.BitcoinAddress, a.StacksRecipient)
+	}
 	// Print contents of the map using minerAddressMap.Range
 	minerAddressMap.Range(func(key, value interface{}) bool {
 		slog.Info("Miner address map", "stx", key, "btc", value)
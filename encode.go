@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/stxpub/codec"
+)
+
+// Transactions are encoded back from the JSON /tx/decode emits. The codec
+// only decodes, so the fields are serialized here in the order and with the
+// sizes it reads them, followed by the bytes it leaves unparsed. Encoding a
+// decoded transaction gives back its exact bytes. NFT post condition asset
+// names are encoded from NFTAssetNames, as their Clarity type can't always be
+// told from their JSON. Without NFTAssetNames, the type is inferred from the
+// JSON: positive integers are encoded as uint and strings as string-ascii
+// when they only have ASCII characters.
+
+// codecEnum is an enum of the codec, marshalled to JSON by name, or as a
+// number for values it has no name for.
+type codecEnum interface {
+	~uint8
+	String() string
+}
+
+// jsonEnum unmarshals a codec enum, rejecting unknown names. The codec's own
+// enums silently unmarshal those as 0.
+type jsonEnum[T codecEnum] struct {
+	Value T
+}
+
+func (e *jsonEnum[T]) UnmarshalText(text []byte) error {
+	for i := 0; i < 256; i++ {
+		if T(i).String() == string(text) {
+			e.Value = T(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %T: %q", e.Value, text)
+}
+
+// The JSON /tx/decode emits, with the codec's enums replaced
+type addressJSON struct {
+	Version   jsonEnum[codec.AddressVersion]
+	HashBytes [20]byte
+}
+
+type principalJSON struct {
+	Type         jsonEnum[codec.PrincipalType]
+	Address      addressJSON
+	ContractName string
+}
+
+type assetInfoJSON struct {
+	Address      addressJSON
+	ContractName string
+	AssetName    string
+}
+
+type spendingConditionJSON struct {
+	HashMode           jsonEnum[codec.HashMode]
+	PubKeyHash         [20]byte
+	Nonce              uint64
+	Fee                uint64
+	SingleSigCondition *codec.SingleSigSpendingCondition
+	MultiSigCondition  *codec.MultiSigSpendingCondition
+}
+
+type postConditionJSON struct {
+	Type jsonEnum[codec.PostConditionType]
+	STX  *struct {
+		Principal principalJSON
+		Code      jsonEnum[codec.FungibleConditionCode]
+		Amount    uint64
+	}
+	FT *struct {
+		Principal principalJSON
+		AssetInfo assetInfoJSON
+		Code      jsonEnum[codec.FungibleConditionCode]
+		Amount    uint64
+	}
+	NFT *struct {
+		Principal principalJSON
+		AssetInfo assetInfoJSON
+		AssetName json.RawMessage
+		Code      jsonEnum[codec.NFTConditionCode]
+	}
+}
+
+type payloadJSON struct {
+	Type     jsonEnum[codec.PayloadType]
+	Transfer *struct {
+		Recipient principalJSON
+		Amount    uint64
+	}
+	ContractDeploy *codec.ContractDeployPayload
+	ContractCall   *struct {
+		Origin   addressJSON
+		Contract string
+		Function string
+	}
+	Coinbase                *codec.CoinbasePayload
+	VersionedContractDeploy *codec.VersionedContractDeployPayload
+	NakamotoCoinbase        *codec.NakamotoCoinbasePayload
+	TenureChange            *struct {
+		ConsensusHash          [20]byte
+		PrevConsensusHash      [20]byte
+		BurnchainConsensusHash [20]byte
+		PrevTenureEnd          [32]byte
+		Cause                  jsonEnum[codec.TenureChangeCause]
+		PubkeyHash             [20]byte
+	}
+}
+
+type txJSON struct {
+	Version       jsonEnum[codec.NetworkVersion]
+	CID           uint32
+	Authorization struct {
+		Type             jsonEnum[codec.AuthorizationType]
+		OriginCondition  spendingConditionJSON
+		SponsorCondition *spendingConditionJSON
+	}
+	AnchorMode        jsonEnum[codec.AnchorMode]
+	PostConditionMode jsonEnum[codec.PostConditionMode]
+	PostConditions    []postConditionJSON
+	Payload           payloadJSON
+	Unparsed          string
+	// Contract call arguments are encoded from Unparsed, their decoded form
+	// is ignored
+	FunctionArgs      json.RawMessage
+	FunctionArgsError string
+	// Serialized NFT post condition asset names, used instead of their
+	// decoded form if set
+	NFTAssetNames []string
+}
+
+// txEncoder serializes a transaction, keeping the first error
+type txEncoder struct {
+	buf bytes.Buffer
+	err error
+	// Serialized NFT asset names left to encode
+	assetNames [][]byte
+}
+
+func (e *txEncoder) fail(format string, args ...any) {
+	if e.err == nil {
+		e.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (e *txEncoder) byte(b byte) {
+	e.buf.WriteByte(b)
+}
+
+func (e *txEncoder) bytes(b []byte) {
+	e.buf.Write(b)
+}
+
+func (e *txEncoder) uint(v any) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+// name encodes a contract, function or asset name, prefixed by its length
+func (e *txEncoder) name(field, s string) {
+	if len(s) == 0 || len(s) > 128 {
+		e.fail("%s must be 1 to 128 bytes long, got %d", field, len(s))
+	}
+	e.byte(byte(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *txEncoder) address(a *addressJSON) {
+	e.byte(byte(a.Version.Value))
+	e.bytes(a.HashBytes[:])
+}
+
+// principal is encoded as the codec decodes it: only standard and contract
+// post condition principals are followed by a contract name.
+func (e *txEncoder) principal(p *principalJSON) {
+	e.byte(byte(p.Type.Value))
+	e.address(&p.Address)
+	if p.Type.Value == codec.PrincipalContract {
+		e.name("contract name", p.ContractName)
+	}
+}
+
+func (e *txEncoder) assetInfo(a *assetInfoJSON) {
+	e.address(&a.Address)
+	e.name("contract name", a.ContractName)
+	e.name("asset name", a.AssetName)
+}
+
+func (e *txEncoder) spendingCondition(sc *spendingConditionJSON) {
+	mode := sc.HashMode.Value
+	e.byte(byte(mode))
+	e.bytes(sc.PubKeyHash[:])
+	e.uint(sc.Nonce)
+	e.uint(sc.Fee)
+	if mode == codec.P2PKH || mode == codec.P2WPKH {
+		if sc.SingleSigCondition == nil {
+			e.fail("hash mode %s requires a SingleSigCondition", mode)
+			return
+		}
+		if sc.SingleSigCondition.PublicKeyEncoding > 0x01 {
+			e.fail("invalid public key encoding %#x", sc.SingleSigCondition.PublicKeyEncoding)
+		}
+		e.byte(sc.SingleSigCondition.PublicKeyEncoding)
+		e.bytes(sc.SingleSigCondition.Signature[:])
+		return
+	}
+	if sc.MultiSigCondition == nil {
+		e.fail("hash mode %s requires a MultiSigCondition", mode)
+		return
+	}
+	e.uint(uint32(len(sc.MultiSigCondition.Authorizations)))
+	for _, field := range sc.MultiSigCondition.Authorizations {
+		size := 65
+		if field.FieldID == 0x00 || field.FieldID == 0x01 {
+			size = 33
+		}
+		if len(field.Body) != size {
+			e.fail("multisig field %#x must be %d bytes long, got %d", field.FieldID, size, len(field.Body))
+		}
+		e.byte(field.FieldID)
+		e.bytes(field.Body)
+	}
+	e.uint(sc.MultiSigCondition.SignatureCount)
+}
+
+func (e *txEncoder) postCondition(pc *postConditionJSON) {
+	e.byte(byte(pc.Type.Value))
+	switch {
+	case pc.Type.Value == codec.STXPostCondition && pc.STX != nil:
+		e.principal(&pc.STX.Principal)
+		e.byte(byte(pc.STX.Code.Value))
+		e.uint(pc.STX.Amount)
+	case pc.Type.Value == codec.FTPostCondition && pc.FT != nil:
+		e.principal(&pc.FT.Principal)
+		e.assetInfo(&pc.FT.AssetInfo)
+		e.byte(byte(pc.FT.Code.Value))
+		e.uint(pc.FT.Amount)
+	case pc.Type.Value == codec.NFTPostCondition && pc.NFT != nil:
+		e.principal(&pc.NFT.Principal)
+		e.assetInfo(&pc.NFT.AssetInfo)
+		if e.assetNames != nil {
+			e.bytes(e.assetNames[0])
+			e.assetNames = e.assetNames[1:]
+		} else if err := encodeClarityJSON(&e.buf, pc.NFT.AssetName); err != nil {
+			e.fail("asset name: %w", err)
+		}
+		e.byte(byte(pc.NFT.Code.Value))
+	default:
+		e.fail("post condition type %s doesn't match its body", pc.Type.Value)
+	}
+}
+
+func (e *txEncoder) contractDeploy(c *codec.ContractDeployPayload) {
+	e.name("contract name", string(c.ContractName))
+	e.uint(uint32(len(c.CodeBody)))
+	e.buf.WriteString(c.CodeBody)
+}
+
+func (e *txEncoder) payload(p *payloadJSON) {
+	e.byte(byte(p.Type.Value))
+	switch {
+	case p.Type.Value == codec.TokenTransfer && p.Transfer != nil:
+		e.principal(&p.Transfer.Recipient)
+		e.uint(p.Transfer.Amount)
+	case p.Type.Value == codec.ContractDeploy && p.ContractDeploy != nil:
+		e.contractDeploy(p.ContractDeploy)
+	case p.Type.Value == codec.ContractCall && p.ContractCall != nil:
+		e.address(&p.ContractCall.Origin)
+		e.name("contract name", p.ContractCall.Contract)
+		e.name("function name", p.ContractCall.Function)
+	case p.Type.Value == codec.Coinbase && p.Coinbase != nil:
+		e.bytes(p.Coinbase.Buffer[:])
+	case p.Type.Value == codec.VersionedContractDeploy && p.VersionedContractDeploy != nil:
+		e.byte(p.VersionedContractDeploy.ClarityVersion)
+		e.contractDeploy(&p.VersionedContractDeploy.ContractDeployPayload)
+	case p.Type.Value == codec.TenureChange && p.TenureChange != nil:
+		tc := p.TenureChange
+		e.bytes(tc.ConsensusHash[:])
+		e.bytes(tc.PrevConsensusHash[:])
+		e.bytes(tc.BurnchainConsensusHash[:])
+		e.bytes(tc.PrevTenureEnd[:])
+		e.byte(byte(tc.Cause.Value))
+		e.bytes(tc.PubkeyHash[:])
+	case p.Type.Value == codec.NakamotoCoinbase && p.NakamotoCoinbase != nil:
+		e.bytes(p.NakamotoCoinbase.Buffer[:])
+		e.bytes(p.NakamotoCoinbase.VRFProof[:])
+	default:
+		e.fail("payload type %s doesn't match its body", p.Type.Value)
+	}
+}
+
+// encodeTx serializes tx
+func encodeTx(tx *txJSON) ([]byte, error) {
+	var e txEncoder
+	if tx.Version.Value == codec.Testnet {
+		e.byte(0x80)
+	} else {
+		e.byte(0x00)
+	}
+	e.uint(tx.CID)
+
+	auth := &tx.Authorization
+	switch {
+	case auth.Type.Value == codec.Standard && auth.SponsorCondition == nil:
+	case auth.Type.Value == codec.Sponsored && auth.SponsorCondition != nil:
+	default:
+		return nil, fmt.Errorf("authorization type %s doesn't match its sponsor condition", auth.Type.Value)
+	}
+	e.byte(byte(auth.Type.Value))
+	e.spendingCondition(&auth.OriginCondition)
+	if auth.SponsorCondition != nil {
+		e.spendingCondition(auth.SponsorCondition)
+	}
+
+	if tx.NFTAssetNames != nil {
+		nfts := 0
+		for _, pc := range tx.PostConditions {
+			if pc.NFT != nil {
+				nfts += 1
+			}
+		}
+		if len(tx.NFTAssetNames) != nfts {
+			return nil, fmt.Errorf("got %d NFTAssetNames for %d NFT post conditions", len(tx.NFTAssetNames), nfts)
+		}
+		e.assetNames = [][]byte{}
+		for i, name := range tx.NFTAssetNames {
+			data, err := hex.DecodeString(name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid NFTAssetNames[%d]: %w", i, err)
+			}
+			e.assetNames = append(e.assetNames, data)
+		}
+	}
+
+	e.byte(byte(tx.AnchorMode.Value))
+	e.byte(byte(tx.PostConditionMode.Value))
+	e.uint(uint32(len(tx.PostConditions)))
+	for i := range tx.PostConditions {
+		e.postCondition(&tx.PostConditions[i])
+	}
+	e.payload(&tx.Payload)
+
+	unparsed, err := hex.DecodeString(tx.Unparsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Unparsed: %w", err)
+	}
+	e.bytes(unparsed)
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	// The codec must read the transaction back as it was given
+	var decoded codec.Transaction
+	if err := decoded.Decode(bytes.NewReader(e.buf.Bytes())); err != nil {
+		return nil, fmt.Errorf("encoded transaction doesn't decode: %w", err)
+	}
+	return e.buf.Bytes(), nil
+}
+
+// parseTxJSON parses a transaction as emitted by /tx/decode
+func parseTxJSON(body []byte) (*txJSON, error) {
+	var tx txJSON
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// encodeClarityJSON serializes a Clarity value as the codec marshals it to
+// JSON, inferring its type from its fields.
+func encodeClarityJSON(buf *bytes.Buffer, data json.RawMessage) error {
+	var v struct {
+		Value   json.RawMessage
+		Data    []byte
+		Version *byte
+		Hash160 [20]byte
+		Name    *string
+		IsOk    *bool
+		Result  json.RawMessage
+		IsSome  *bool
+		Values  json.RawMessage
+		Length  uint32
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch {
+	case v.IsOk != nil:
+		if *v.IsOk {
+			buf.WriteByte(0x07)
+		} else {
+			buf.WriteByte(0x08)
+		}
+		return encodeClarityJSON(buf, v.Result)
+	case v.IsSome != nil:
+		if !*v.IsSome || len(v.Value) == 0 || string(v.Value) == "null" {
+			buf.WriteByte(0x09)
+			return nil
+		}
+		buf.WriteByte(0x0a)
+		return encodeClarityJSON(buf, v.Value)
+	case v.Version != nil:
+		if v.Name == nil {
+			buf.WriteByte(0x05)
+		} else {
+			buf.WriteByte(0x06)
+		}
+		buf.WriteByte(*v.Version)
+		buf.Write(v.Hash160[:])
+		if v.Name != nil {
+			if len(*v.Name) == 0 || len(*v.Name) > 128 {
+				return fmt.Errorf("invalid contract name %q", *v.Name)
+			}
+			buf.WriteByte(byte(len(*v.Name)))
+			buf.WriteString(*v.Name)
+		}
+		return nil
+	case v.Data != nil:
+		buf.WriteByte(0x02)
+		binary.Write(buf, binary.BigEndian, uint32(len(v.Data)))
+		buf.Write(v.Data)
+		return nil
+	case bytes.HasPrefix(v.Values, []byte("[")):
+		var values []json.RawMessage
+		if err := json.Unmarshal(v.Values, &values); err != nil {
+			return err
+		}
+		buf.WriteByte(0x0b)
+		binary.Write(buf, binary.BigEndian, uint32(len(values)))
+		for _, value := range values {
+			if err := encodeClarityJSON(buf, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case bytes.HasPrefix(v.Values, []byte("{")):
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(v.Values, &values); err != nil {
+			return err
+		}
+		buf.WriteByte(0x0c)
+		binary.Write(buf, binary.BigEndian, uint32(len(values)))
+		// Tuples are serialized with their keys sorted
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if len(name) == 0 || len(name) > 128 {
+				return fmt.Errorf("invalid tuple key %q", name)
+			}
+			buf.WriteByte(byte(len(name)))
+			buf.WriteString(name)
+			if err := encodeClarityJSON(buf, values[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	value := bytes.TrimSpace(v.Value)
+	switch {
+	case len(value) == 0:
+		return errors.New("unknown Clarity value")
+	case string(value) == "true":
+		buf.WriteByte(0x03)
+	case string(value) == "false":
+		buf.WriteByte(0x04)
+	case value[0] == '"':
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return err
+		}
+		ascii := true
+		for i := 0; i < len(s); i++ {
+			ascii = ascii && s[i] < utf8.RuneSelf
+		}
+		if ascii {
+			buf.WriteByte(0x0d)
+		} else {
+			buf.WriteByte(0x0e)
+		}
+		binary.Write(buf, binary.BigEndian, uint32(len(s)))
+		buf.WriteString(s)
+	default:
+		n, ok := new(big.Int).SetString(string(value), 10)
+		if !ok {
+			return fmt.Errorf("invalid Clarity integer %s", value)
+		}
+		// Negative integers are int128, in two's complement
+		limit := new(big.Int).Lsh(big.NewInt(1), 128)
+		if n.Sign() < 0 {
+			buf.WriteByte(0x00)
+			if n.CmpAbs(new(big.Int).Rsh(limit, 1)) > 0 {
+				return fmt.Errorf("Clarity integer %s out of range", value)
+			}
+			n.Add(n, limit)
+		} else {
+			buf.WriteByte(0x01)
+			if n.Cmp(limit) >= 0 {
+				return fmt.Errorf("Clarity integer %s out of range", value)
+			}
+		}
+		buf.Write(n.FillBytes(make([]byte, 16)))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Decoding each transaction with /tx/decode and encoding the JSON back with
+// /tx/encode must give back its bytes
+func TestEncodeDecodedTx(t *testing.T) {
+	f, err := os.Open("testdata/transactions.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		name, txHex, ok := strings.Cut(s.Text(), " ")
+		if !ok || strings.HasPrefix(name, "#") {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleTxDecode(w, httptest.NewRequest(http.MethodPost, "/tx/decode", strings.NewReader(txHex)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("/tx/decode: %d %s", w.Code, w.Body)
+			}
+			decoded := w.Body.String()
+
+			w = httptest.NewRecorder()
+			handleTxEncode(w, httptest.NewRequest(http.MethodPost, "/tx/encode", strings.NewReader(decoded)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("/tx/encode: %d %s", w.Code, w.Body)
+			}
+			if w.Body.String() != txHex {
+				t.Errorf("/tx/encode = %s, want %s", w.Body, txHex)
+			}
+		})
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeNFTAssetNames(t *testing.T) {
+	// nft-uint-asset-name from testdata/transactions.txt
+	raw, _ := hex.DecodeString("00000000010400c9b312d56d425197006d8c072f3d566519c8b58a000000000000073b0000000000000bb8000034c7527ce17586aad93fb1485083ec10c9184bda63f18676d8a30ec604efb18f25ef86f5e284cdee13d2398a973d5e6fac2488ab1236c37c77b63c8304f24edf030200000001020216c9b312d56d425197006d8c072f3d566519c8b58a16c9b312d56d425197006d8c072f3d566519c8b58a076d656d706f6f6c076d656d706f6f6c0100000000000000000000000000000072100216c9b312d56d425197006d8c072f3d566519c8b58a076d656d706f6f6c087472616e736665720000000301000000000000000000000000000000720516c9b312d56d425197006d8c072f3d566519c8b58a051638c216c895ec1dc1356d6d237fb6dfc9dec26034")
+	tx, err := decodeRawTx(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0100000000000000000000000000000072"}
+	if len(tx.NFTAssetNames) != 1 || tx.NFTAssetNames[0] != want[0] {
+		t.Errorf("NFTAssetNames = %v, want %v", tx.NFTAssetNames, want)
+	}
+
+	tests := []struct {
+		name       string
+		assetNames string
+		valid      bool
+	}{
+		{"raw asset name", `["0100000000000000000000000000000072"]`, true},
+		// uint asset names are inferred from the JSON
+		{"inferred asset name", `null`, true},
+		{"missing asset name", `[]`, false},
+		{"extra asset name", `["0109", "0109"]`, false},
+		{"invalid hex", `["01zz"]`, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handleTxDecode(w, httptest.NewRequest(http.MethodPost, "/tx/decode", strings.NewReader(hex.EncodeToString(raw))))
+		body := strings.Replace(w.Body.String(), `"NFTAssetNames":["0100000000000000000000000000000072"]`,
+			`"NFTAssetNames":`+tt.assetNames, 1)
+		tx, err := parseTxJSON([]byte(body))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		encoded, err := encodeTx(tx)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: encodeTx error = %v, want valid %v", tt.name, err, tt.valid)
+			continue
+		}
+		if tt.valid && hex.EncodeToString(encoded) != hex.EncodeToString(raw) {
+			t.Errorf("%s: encodeTx = %x, want %x", tt.name, encoded, raw)
+		}
+	}
+}
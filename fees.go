@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// Minimum fee rate a node will relay, in uSTX per byte
+	minFeeRate = 1.0
+	// Size of a typical STX transfer, in bytes
+	tokenTransferSize = 180
+	// Size of a typical contract call, in bytes
+	contractCallSize = 300
+	// Number of Bitcoin blocks of mined Stacks blocks to consider
+	feeEstimateBurnBlocks = 6
+)
+
+// FeeRates holds the low, medium and high quantiles (25%, 50% and 90%) of a
+// fee rate distribution, or fee recommendations, in uSTX per byte.
+type FeeRates struct {
+	Low    float64
+	Medium float64
+	High   float64
+}
+
+// Fees holds fee recommendations in uSTX for a transaction of a given size
+type Fees struct {
+	Low    int
+	Medium int
+	High   int
+}
+
+type FeeEstimate struct {
+	MempoolSize     int
+	MempoolFeeRates FeeRates
+	MinedBlocks     int
+	MinedFeeRates   FeeRates
+	// Recommended fee rates, in uSTX per byte
+	FeeRates      FeeRates
+	TokenTransfer Fees
+	ContractCall  Fees
+}
+
+// quantile returns the q quantile of sorted, which must not be empty
+func quantile(sorted []float64, q float64) float64 {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+func feeRateQuantiles(rates []float64) FeeRates {
+	if len(rates) == 0 {
+		return FeeRates{}
+	}
+	slices.Sort(rates)
+	return FeeRates{
+		Low:    quantile(rates, 0.25),
+		Medium: quantile(rates, 0.5),
+		High:   quantile(rates, 0.9),
+	}
+}
+
+func (r FeeRates) fees(size int) Fees {
+	return Fees{
+		Low:    int(math.Ceil(r.Low * float64(size))),
+		Medium: int(math.Ceil(r.Medium * float64(size))),
+		High:   int(math.Ceil(r.High * float64(size))),
+	}
+}
+
+// minedFeeRates returns the average fee rate of each Stacks block mined in the
+// last burnBlocks Bitcoin blocks, skipping blocks that paid no fees.
+func minedFeeRates(burnBlocks int) ([]float64, error) {
+	cdb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, chainstateDb))
+	defer cdb.Close()
+
+	// tenure_tx_fees is a running total over the tenure, so a block's own
+	// fees are the difference from its parent unless it starts a tenure.
+	const query = `
+	SELECT
+		index_block_hash,
+		parent_block_id,
+		block_size,
+		tenure_changed,
+		tenure_tx_fees
+	FROM nakamoto_block_headers
+	WHERE burn_header_height > (SELECT MAX(burn_header_height) FROM nakamoto_block_headers) - ?
+	ORDER BY block_height ASC
+	`
+	var blocks []struct {
+		IndexBlockHash string `db:"index_block_hash"`
+		ParentBlockId  string `db:"parent_block_id"`
+		BlockSize      int    `db:"block_size"`
+		TenureChanged  bool   `db:"tenure_changed"`
+		TenureTxFees   int    `db:"tenure_tx_fees"`
+	}
+	if err := cdb.Select(&blocks, query, burnBlocks); err != nil {
+		return nil, err
+	}
+
+	tenureFees := make(map[string]int)
+	rates := []float64{}
+	for _, b := range blocks {
+		tenureFees[b.IndexBlockHash] = b.TenureTxFees
+		fees := b.TenureTxFees
+		if !b.TenureChanged {
+			parentFees, exists := tenureFees[b.ParentBlockId]
+			if !exists {
+				continue
+			}
+			fees -= parentFees
+		}
+		if fees > 0 && b.BlockSize > 0 {
+			rates = append(rates, float64(fees)/float64(b.BlockSize))
+		}
+	}
+	return rates, nil
+}
+
+// estimateFees recommends fee rates from the fee rates currently in the
+// mempool and those of recently mined blocks. Low is what recent blocks have
+// been including at the bottom end, while medium and high also have to
+// compete with what is waiting in the mempool.
+func estimateFees(mempoolRates []float64, minedRates []float64) FeeEstimate {
+	e := FeeEstimate{
+		MempoolSize:     len(mempoolRates),
+		MempoolFeeRates: feeRateQuantiles(mempoolRates),
+		MinedBlocks:     len(minedRates),
+		MinedFeeRates:   feeRateQuantiles(minedRates),
+	}
+	low := e.MinedFeeRates.Low
+	if len(minedRates) == 0 {
+		low = e.MempoolFeeRates.Low
+	}
+	e.FeeRates.Low = max(low, minFeeRate)
+	e.FeeRates.Medium = max(e.MinedFeeRates.Medium, e.MempoolFeeRates.Medium, e.FeeRates.Low)
+	e.FeeRates.High = max(e.MinedFeeRates.High, e.MempoolFeeRates.High, e.FeeRates.Medium)
+	e.TokenTransfer = e.FeeRates.fees(tokenTransferSize)
+	e.ContractCall = e.FeeRates.fees(contractCallSize)
+	return e
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of chain quality events
+const (
+	// A sortition winner whose tenure is not on the canonical chain
+	OrphanedTenure = "orphaned-tenure"
+	// A block commit that does not build on the latest canonical sortition
+	// winner
+	StaleParent = "stale-parent"
+	// A burn block without a sortition winner. Burn blocks whose winner was
+	// orphaned are reported as OrphanedTenure instead.
+	NoCanonicalWinner = "no-canonical-winner"
+)
+
+// Most burn blocks backfillForkEvents scans at startup, a week
+const maxForkBackfillBlocks = 144 * 7
+
+type ForkEvent struct {
+	Timestamp          time.Time `db:"timestamp"`
+	BitcoinBlockHeight int       `db:"bitcoin_block_height"`
+	Type               string    `db:"type"`
+	Txid               string    `db:"txid"`
+	Sender             string    `db:"sender"`
+	Parent             string    `db:"parent"`
+	Details            string    `db:"details"`
+}
+
+// detectForkEvents looks for orphaned tenures, commits building off stale
+// tips and burn blocks without a canonical winner in the burn blocks
+// [lower_bound_height, start_block].
+func detectForkEvents(lower_bound_height, start_block int, blockCommits BlockCommits) []ForkEvent {
+	// Canonical flags are only meaningful when the walk back from the tip
+	// found a tip, which it doesn't if the last sortition had no winner.
+	hasTip := false
+	for _, commit := range blockCommits.AllCommits {
+		hasTip = hasTip || commit.tip
+	}
+	if !hasTip {
+		slog.Info("No canonical tip, skipping fork detection", "height", start_block)
+		return nil
+	}
+
+	events := []ForkEvent{}
+	// Commits should build on the canonical chain, not on orphaned winners
+	var lastWinner *BlockCommit
+	for block_height := lower_bound_height; block_height <= start_block; block_height++ {
+		var winner *BlockCommit
+		for _, commit := range blockCommits.CommitsByBlock[block_height] {
+			if commit.won {
+				winner = commit
+			}
+			if lastWinner != nil && commit.parentKey != lastWinner.key {
+				events = append(events, ForkEvent{
+					BitcoinBlockHeight: block_height,
+					Type:               StaleParent,
+					Txid:               commit.txid,
+					Sender:             strings.Trim(commit.sender, `"`),
+					Parent:             commit.parent,
+					Details: fmt.Sprintf("builds on burn block %d instead of the winner at %d",
+						commit.parentBlockPtr, lastWinner.burnBlockHeight),
+				})
+			}
+		}
+
+		if winner != nil && !winner.canonical {
+			events = append(events, ForkEvent{
+				BitcoinBlockHeight: block_height,
+				Type:               OrphanedTenure,
+				Txid:               winner.txid,
+				Sender:             strings.Trim(winner.sender, `"`),
+				Parent:             winner.parent,
+				Details:            "sortition winner is not on the canonical chain",
+			})
+		}
+		// The start of the window can't be judged, its parents are outside it
+		if lastWinner != nil && winner == nil {
+			events = append(events, ForkEvent{
+				BitcoinBlockHeight: block_height,
+				Type:               NoCanonicalWinner,
+				Details:            "no sortition winner",
+			})
+		}
+		if winner != nil && winner.canonical {
+			lastWinner = winner
+		}
+	}
+	return events
+}
+
+// recordForkEvents stores events that haven't been seen before and alerts on
+// them, returning the new ones.
+func recordForkEvents(hubDb *sqlx.DB, events []ForkEvent) ([]ForkEvent, error) {
+	tx, err := hubDb.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	recorded := []ForkEvent{}
+	for _, e := range events {
+		res, err := tx.NamedExec(`INSERT OR IGNORE INTO fork_events
+			(bitcoin_block_height, type, txid, sender, parent, details)
+			VALUES (:bitcoin_block_height, :type, :txid, :sender, :parent, :details)`, e)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			e.Timestamp = time.Now().UTC()
+			recorded = append(recorded, e)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, e := range recorded {
+		slog.Warn("Fork event", "type", e.Type, "height", e.BitcoinBlockHeight,
+			"txid", e.Txid, "sender", e.Sender, "details", e.Details)
+	}
+	if config.ForkAlertURL != "" && len(recorded) > 0 {
+		// Don't hold up the caller on a slow webhook, postForkAlert times out
+		go func() {
+			if err := postForkAlert(recorded); err != nil {
+				slog.Warn("Error posting fork alert", "url", config.ForkAlertURL, "error", err)
+			}
+		}()
+	}
+	return recorded, nil
+}
+
+// backfillForkEvents detects the fork events of the burn blocks mined since
+// the last dotsTask run, as dotsTask only looks at the latest ones. At most
+// maxForkBackfillBlocks are scanned.
+func backfillForkEvents() error {
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite"))
+	defer hubDb.Close()
+
+	var last *int
+	if err := hubDb.Get(&last, "SELECT MAX(bitcoin_block_height) FROM dots"); err != nil {
+		return err
+	}
+	if last == nil {
+		// Nothing was scanned before, so nothing was missed
+		return nil
+	}
+
+	db, cdb := openDatabases()
+	defer db.Close()
+	defer cdb.Close()
+
+	var tip, first int
+	if err := db.Get(&tip, "SELECT COALESCE(MAX(block_height), 0) FROM block_commits"); err != nil {
+		return err
+	}
+	if err := db.Get(&first, "SELECT COALESCE(MIN(block_height), 0) FROM snapshots"); err != nil {
+		return err
+	}
+	if tip <= *last {
+		return nil
+	}
+	// Start a window before the last run, whose own start couldn't be judged
+	lowerBound := max(*last-dotsWindowBlocks, tip-maxForkBackfillBlocks, first)
+	slog.Info("Backfilling fork events", "from", lowerBound, "to", tip)
+
+	blockCommits, err := collectBlockCommits(db, cdb, lowerBound, tip)
+	if err != nil {
+		return err
+	}
+	_, err = recordForkEvents(hubDb, detectForkEvents(lowerBound, tip, blockCommits))
+	return err
+}
+
+// postForkAlert sends new events as a JSON array to the configured webhook
+func postForkAlert(events []ForkEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(config.ForkAlertURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// getForkEvents returns the recorded events in the burn blocks
+// (lowerBound, upperBound], newest first, optionally of a single type.
+func getForkEvents(hubDb *sqlx.DB, lowerBound, upperBound int, eventType string) []ForkEvent {
+	query := `SELECT timestamp, bitcoin_block_height, type, txid,
+		COALESCE(sender, '') AS sender, COALESCE(parent, '') AS parent, COALESCE(details, '') AS details
+	FROM fork_events
+	WHERE bitcoin_block_height > ? AND bitcoin_block_height <= ?`
+	args := []any{lowerBound, upperBound}
+	if eventType != "" {
+		query += " AND type = ?"
+		args = append(args, eventType)
+	}
+	query += " ORDER BY bitcoin_block_height DESC, id DESC"
+
+	events := []ForkEvent{}
+	if err := hubDb.Select(&events, query, args...); err != nil {
+		slog.Warn("Error fetching fork events", "error", err)
+	}
+	return events
+}
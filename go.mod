@@ -4,6 +4,7 @@ go 1.23.1
 
 require (
 	github.com/HdrHistogram/hdrhistogram-go v1.1.2
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.1
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/go-chi/cors v1.2.1
 	github.com/go-chi/httplog/v2 v2.1.1
@@ -13,6 +14,7 @@ require (
 	github.com/pelletier/go-toml/v2 v2.2.3
 	github.com/stxpub/codec v0.0.0-20241210173909-e24ecb74fd6f
 	github.com/tidwall/gjson v1.18.0
+	golang.org/x/crypto v0.31.0
 )
 
 require (
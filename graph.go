@@ -0,0 +1,326 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GraphNode is a block commit in the block-commit graph
+type GraphNode struct {
+	Txid            string
+	Sender          string
+	BurnBlockHeight int
+	Vtxindex        int
+	Spend           int
+	Memo            string
+	StacksHeight    int
+	BlockHash       string
+	Won             bool
+	Canonical       bool
+	Tip             bool
+}
+
+// GraphEdge links a block commit to the commit it builds on
+type GraphEdge struct {
+	Parent    string
+	Child     string
+	Canonical bool
+	// Set when the parent is not in the previous burn block with commits
+	MissedParent bool
+}
+
+// GraphBlock is a Bitcoin block that has block commits in the graph
+type GraphBlock struct {
+	BurnBlockHeight int
+	SortitionSpend  int
+}
+
+// Graph is the JSON equivalent of the DOT produced by generateGraph
+type Graph struct {
+	BitcoinBlockHeight int
+	LowerBound         int
+	Blocks             []GraphBlock
+	Nodes              []GraphNode
+	Edges              []GraphEdge
+}
+
+// buildGraph lays out the same nodes and edges as generateGraph, for clients
+// that would rather not parse DOT.
+func buildGraph(lower_bound_height, start_block int, blockCommits BlockCommits) Graph {
+	g := Graph{
+		BitcoinBlockHeight: start_block,
+		LowerBound:         lower_bound_height,
+		Blocks:             []GraphBlock{},
+		Nodes:              []GraphNode{},
+		Edges:              []GraphEdge{},
+	}
+	commits := blockCommits.AllCommits
+
+	last_height := 0
+	for block_height := lower_bound_height; block_height <= start_block; block_height++ {
+		block_commits, exists := blockCommits.CommitsByBlock[block_height]
+		if !exists {
+			continue // skip blocks that don't have any commits
+		}
+
+		sortition_spend := 0
+		for _, commit := range block_commits {
+			if sortition_spend == 0 {
+				sortition_spend = blockCommits.SortitionFeesMap[commit.sortitionId]
+			}
+			g.Nodes = append(g.Nodes, GraphNode{
+				Txid:            commit.txid,
+				Sender:          strings.Trim(commit.sender, `"`),
+				BurnBlockHeight: commit.burnBlockHeight,
+				Vtxindex:        commit.vtxindex,
+				Spend:           commit.spend,
+				Memo:            commit.memo,
+				StacksHeight:    commit.stacksHeight,
+				BlockHash:       commit.blockHash,
+				Won:             commit.won,
+				Canonical:       commit.canonical,
+				Tip:             commit.tip,
+			})
+			if commit.parent != "" {
+				g.Edges = append(g.Edges, GraphEdge{
+					Parent:       commit.parent,
+					Child:        commit.txid,
+					Canonical:    commit.canonical,
+					MissedParent: parentMissed(commits[commit.parent], last_height),
+				})
+			}
+		}
+		g.Blocks = append(g.Blocks, GraphBlock{
+			BurnBlockHeight: block_height,
+			SortitionSpend:  sortition_spend,
+		})
+		last_height = block_height
+	}
+	return g
+}
+
+// How long a graph built for /miners/viz/range is reused. Graphs that reach
+// the tip change as new blocks are mined, so don't keep them too long.
+const rangeGraphTTL = 10 * time.Minute
+
+type graphRange struct {
+	lowerBound int
+	upperBound int
+}
+
+type rangeGraph struct {
+	dot   string
+	graph Graph
+	built time.Time
+}
+
+// rangeCache holds graphs built on demand by burn height range
+var rangeCache = struct {
+	sync.Mutex
+	graphs map[graphRange]rangeGraph
+}{graphs: make(map[graphRange]rangeGraph)}
+
+// buildRangeGraph runs the block commit pipeline over the burn blocks
+// (lowerBound, upperBound], reusing a recent result for the same range.
+func buildRangeGraph(db *sqlx.DB, cdb *sqlx.DB, lowerBound, upperBound int) (rangeGraph, error) {
+	key := graphRange{lowerBound, upperBound}
+	rangeCache.Lock()
+	cached, exists := rangeCache.graphs[key]
+	rangeCache.Unlock()
+	if exists && time.Since(cached.built) < rangeGraphTTL {
+		return cached, nil
+	}
+
+	blockCommits, err := collectBlockCommits(db, cdb, lowerBound+1, upperBound)
+	if err != nil {
+		return rangeGraph{}, err
+	}
+	built := rangeGraph{
+		dot:   generateGraph(lowerBound+1, upperBound, blockCommits),
+		graph: buildGraph(lowerBound+1, upperBound, blockCommits),
+		built: time.Now(),
+	}
+
+	rangeCache.Lock()
+	defer rangeCache.Unlock()
+	maps.DeleteFunc(rangeCache.graphs, func(_ graphRange, g rangeGraph) bool {
+		return time.Since(g.built) >= rangeGraphTTL
+	})
+	if len(rangeCache.graphs) < maxCachedGraph {
+		rangeCache.graphs[key] = built
+	}
+	return built, nil
+}
+
+// senderColor is the fill color of the commits of sender. It is picked from
+// the quoted apparent_sender, as generateGraph does, so that a miner has the
+// same color in the SVG and DOT visualizations.
+func senderColor(sender string) string {
+	return stringToColor(`"` + sender + `"`)
+}
+
+// Dimensions of the rendered SVG, in pixels
+const (
+	svgNodeWidth   = 220
+	svgNodeHeight  = 92
+	svgNodeGap     = 30
+	svgRowGap      = 70
+	svgLabelWidth  = 180
+	svgMargin      = 20
+	svgLineHeight  = 20
+	maxCachedGraph = 16
+)
+
+// svgCache holds rendered block-commit graphs by Bitcoin block height
+var svgCache = struct {
+	sync.Mutex
+	images map[int][]byte
+}{images: make(map[int][]byte)}
+
+// cachedGraphSVG returns the rendered SVG for the graph at height, rendering
+// and caching it with render if it is not cached yet.
+func cachedGraphSVG(height int, render func() ([]byte, error)) ([]byte, error) {
+	svgCache.Lock()
+	image, exists := svgCache.images[height]
+	svgCache.Unlock()
+	if exists {
+		return image, nil
+	}
+
+	image, err := render()
+	if err != nil {
+		return nil, err
+	}
+
+	svgCache.Lock()
+	defer svgCache.Unlock()
+	svgCache.images[height] = image
+	// Evict the lowest heights first, those are the least likely to be asked for
+	for len(svgCache.images) > maxCachedGraph {
+		delete(svgCache.images, slices.Min(slices.Collect(maps.Keys(svgCache.images))))
+	}
+	return image, nil
+}
+
+type svgPoint struct {
+	x, y int
+}
+
+// renderGraphSVG draws the graph as an SVG with one row per Bitcoin block,
+// oldest at the top, using the same colours and line styles as the DOT.
+func renderGraphSVG(g Graph) []byte {
+	// Group the nodes into rows by burn block height
+	rows := make(map[int][]GraphNode)
+	for _, node := range g.Nodes {
+		rows[node.BurnBlockHeight] = append(rows[node.BurnBlockHeight], node)
+	}
+	parents := make(map[string]string)
+	for _, edge := range g.Edges {
+		parents[edge.Child] = edge.Parent
+	}
+
+	// Place each row in turn, ordering the nodes by the position of their
+	// parent so that edges cross as little as possible.
+	pos := make(map[string]svgPoint)
+	widest := 0
+	for i, block := range g.Blocks {
+		row := rows[block.BurnBlockHeight]
+		slices.SortFunc(row, func(a, b GraphNode) int {
+			pa, okA := pos[parents[a.Txid]]
+			pb, okB := pos[parents[b.Txid]]
+			if okA && okB && pa.x != pb.x {
+				return cmp.Compare(pa.x, pb.x)
+			}
+			return cmp.Compare(a.Txid, b.Txid)
+		})
+		y := svgMargin + i*(svgNodeHeight+svgRowGap)
+		for j, node := range row {
+			x := svgMargin + svgLabelWidth + j*(svgNodeWidth+svgNodeGap)
+			pos[node.Txid] = svgPoint{x, y}
+		}
+		widest = max(widest, len(row))
+	}
+	width := 2*svgMargin + svgLabelWidth + widest*(svgNodeWidth+svgNodeGap)
+	height := 2*svgMargin + len(g.Blocks)*(svgNodeHeight+svgRowGap)
+
+	var w strings.Builder
+	w.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="14">`+"\n",
+		width, height, width, height))
+	w.WriteString(fmt.Sprintf(`<rect width="%d" height="%d" fill="white"/>`+"\n", width, height))
+
+	// Block labels, one per row
+	for i, block := range g.Blocks {
+		y := svgMargin + i*(svgNodeHeight+svgRowGap)
+		w.WriteString(fmt.Sprintf(`<a href="https://mempool.space/block/%d"><text x="%d" y="%d" font-size="18">₿ %d</text></a>`+"\n",
+			block.BurnBlockHeight, svgMargin, y+svgNodeHeight/2, block.BurnBlockHeight))
+		w.WriteString(fmt.Sprintf(`<text x="%d" y="%d" font-size="18">💰 %dK sats</text>`+"\n",
+			svgMargin, y+svgNodeHeight/2+svgLineHeight+4, block.SortitionSpend/1000))
+	}
+
+	// Edges go under the nodes, so draw them first
+	for _, edge := range g.Edges {
+		from, okFrom := pos[edge.Parent]
+		to, okTo := pos[edge.Child]
+		if !okFrom || !okTo {
+			continue
+		}
+		color, penwidth := "black", 1
+		if edge.MissedParent {
+			color, penwidth = "red", 4
+		}
+		if edge.Canonical {
+			color, penwidth = "blue", 8
+		}
+		x1, y1 := from.x+svgNodeWidth/2, from.y+svgNodeHeight
+		x2, y2 := to.x+svgNodeWidth/2, to.y
+		mid := (y1 + y2) / 2
+		w.WriteString(fmt.Sprintf(`<path d="M %d %d C %d %d, %d %d, %d %d" fill="none" stroke="%s" stroke-width="%d"/>`+"\n",
+			x1, y1, x1, mid, x2, mid, x2, y2, color, penwidth))
+	}
+
+	for _, node := range g.Nodes {
+		p := pos[node.Txid]
+		color, penwidth, dash := "black", 1, ` stroke-dasharray="6 4"`
+		if node.Won {
+			color, penwidth = "blue", 4
+		}
+		if node.Tip {
+			penwidth = 8
+		}
+		if node.Canonical {
+			dash = ""
+		}
+		url := "https://mempool.space/tx/" + node.Txid
+		if node.BlockHash != "" {
+			url = "https://explorer.hiro.so/block/0x" + node.BlockHash
+		}
+		sender := node.Sender
+		if len(sender) > 8 {
+			sender = sender[:8]
+		}
+		w.WriteString(fmt.Sprintf(`<a href="%s">`, html.EscapeString(url)))
+		w.WriteString(fmt.Sprintf(`<rect x="%d" y="%d" width="%d" height="%d" rx="6" fill="%s" stroke="%s" stroke-width="%d"%s/>`,
+			p.x, p.y, svgNodeWidth, svgNodeHeight, senderColor(node.Sender), color, penwidth, dash))
+		lines := []string{
+			fmt.Sprintf("⛏️ %s", sender),
+			fmt.Sprintf("🔗 %d", node.StacksHeight),
+			fmt.Sprintf("💸 %dK sats", node.Spend/1000),
+			fmt.Sprintf("memo: %s", node.Memo),
+		}
+		for i, line := range lines {
+			w.WriteString(fmt.Sprintf(`<text x="%d" y="%d">%s</text>`,
+				p.x+10, p.y+svgLineHeight*(i+1), html.EscapeString(line)))
+		}
+		w.WriteString("</a>\n")
+	}
+	w.WriteString("</svg>\n")
+	return []byte(w.String())
+}
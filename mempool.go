@@ -0,0 +1,351 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stxpub/codec"
+)
+
+const (
+	defaultMempoolPageSize = 50
+	maxMempoolPageSize     = 500
+)
+
+type mempoolTxn struct {
+	Txid   string `db:"txid"`
+	TxFee  int    `db:"tx_fee"`
+	Length int    `db:"length"`
+	Age    int    `db:"age"`
+	TxBlob string `db:"tx"`
+}
+
+// readMempool loads every transaction currently in the node's mempool
+func readMempool() ([]mempoolTxn, error) {
+	mdb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, mempoolDb))
+	defer mdb.Close()
+
+	mempool := []mempoolTxn{}
+	err := mdb.Select(&mempool,
+		"SELECT txid, tx_fee, length, (unixepoch() - accept_time) as age, LOWER(HEX(tx)) AS tx FROM mempool")
+	return mempool, err
+}
+
+// FeeRate is the fee paid per byte, which is what orders inclusion
+func (txn mempoolTxn) FeeRate() float64 {
+	if txn.Length == 0 {
+		return 0
+	}
+	return float64(txn.TxFee) / float64(txn.Length)
+}
+
+// MempoolTx is a decoded mempool transaction as listed by /mempool/txs
+type MempoolTx struct {
+	Txid        string
+	Sender      string
+	Nonce       uint64
+	Sponsor     string
+	PayloadType string
+	Contract    string
+	Function    string
+	// Decoded arguments of contract calls, or the error decoding them. Left
+	// out of MempoolTxDetail, whose Transaction has them.
+	FunctionArgs      []ClarityValue `json:",omitempty"`
+	FunctionArgsError string         `json:",omitempty"`
+	Fee               int
+	Length            int
+	FeeRate           float64
+	Age               int
+	// Position by fee rate among the decoded mempool transactions, starting
+	// at 1. Transactions paying the same fee rate share it.
+	Rank int
+}
+
+type MempoolTxPage struct {
+	Total        int
+	Offset       int
+	Limit        int
+	Transactions []MempoolTx
+}
+
+// rankMempool orders txs by fee rate, highest first, and ranks them. A
+// transaction's rank is one more than the number of transactions paying a
+// higher fee rate, so transactions paying the same rate share it.
+func rankMempool(txs []MempoolTx) {
+	slices.SortStableFunc(txs, func(a, b MempoolTx) int {
+		return cmp.Compare(b.FeeRate, a.FeeRate)
+	})
+	for i := range txs {
+		if i > 0 && txs[i].FeeRate == txs[i-1].FeeRate {
+			txs[i].Rank = txs[i-1].Rank
+		} else {
+			txs[i].Rank = i + 1
+		}
+	}
+}
+
+// mempoolSnapshot is the mempool as mempoolTask last read and decoded it, so
+// that requests don't read and decode it all over again
+var mempoolSnapshot struct {
+	sync.RWMutex
+	// Unix time the mempool was read at, 0 until it first is
+	readAt int64
+	// In rank order
+	txs []MempoolTx
+	// Decoded transactions by txid
+	decoded map[string]Tx
+}
+
+// setMempoolSnapshot ranks txs, the decoded mempool read at readAt, and makes
+// them the mempool snapshot
+func setMempoolSnapshot(readAt int64, txs []MempoolTx, decoded map[string]Tx) {
+	rankMempool(txs)
+	mempoolSnapshot.Lock()
+	defer mempoolSnapshot.Unlock()
+	mempoolSnapshot.readAt = readAt
+	mempoolSnapshot.txs = txs
+	mempoolSnapshot.decoded = decoded
+}
+
+// currentMempool returns a copy of the mempool snapshot in rank order, with
+// ages as of now. The second return value is false if the mempool wasn't
+// read yet.
+func currentMempool() ([]MempoolTx, bool) {
+	mempoolSnapshot.RLock()
+	defer mempoolSnapshot.RUnlock()
+	if mempoolSnapshot.readAt == 0 {
+		return nil, false
+	}
+	elapsed := int(time.Now().Unix() - mempoolSnapshot.readAt)
+	txs := slices.Clone(mempoolSnapshot.txs)
+	for i := range txs {
+		txs[i].Age += elapsed
+	}
+	return txs, true
+}
+
+func newMempoolTx(txn mempoolTxn, tx *Tx) MempoolTx {
+	return MempoolTx{
+		Txid:              txn.Txid,
+		Sender:            txSender(&tx.Transaction),
+		Nonce:             tx.Authorization.OriginCondition.Nonce,
+		Sponsor:           txSponsor(&tx.Transaction),
+		PayloadType:       tx.Payload.Type.String(),
+		Contract:          txContract(&tx.Transaction),
+		Function:          txFunction(&tx.Transaction),
+		FunctionArgs:      tx.FunctionArgs,
+		FunctionArgsError: tx.FunctionArgsError,
+		Fee:               txn.TxFee,
+		Length:            txn.Length,
+		FeeRate:           txn.FeeRate(),
+		Age:               txn.Age,
+	}
+}
+
+// MempoolTxDetail is a single mempool transaction with its decoded payload
+// and how its fee rate compares to the rest of the mempool
+type MempoolTxDetail struct {
+	MempoolTx
+	// Percentage of mempool transactions paying a lower fee rate
+	Percentile  float64
+	MempoolSize int
+	Transaction Tx
+}
+
+// findMempoolTx looks up txid in the mempool snapshot, ranked by fee rate
+// against every other transaction of the snapshot. The second return value is
+// false if txid is not in the mempool, and the error is set if the mempool
+// wasn't read yet.
+func findMempoolTx(txid string) (MempoolTxDetail, bool, error) {
+	txid = strings.ToLower(strings.TrimPrefix(txid, "0x"))
+	mempoolSnapshot.RLock()
+	defer mempoolSnapshot.RUnlock()
+	if mempoolSnapshot.readAt == 0 {
+		return MempoolTxDetail{}, false, errors.New("mempool not read yet")
+	}
+	txs := mempoolSnapshot.txs
+	i := slices.IndexFunc(txs, func(tx MempoolTx) bool {
+		return tx.Txid == txid
+	})
+	if i < 0 {
+		return MempoolTxDetail{}, false, nil
+	}
+
+	detail := MempoolTxDetail{
+		MempoolTx:   txs[i],
+		MempoolSize: len(txs),
+		Transaction: mempoolSnapshot.decoded[txid],
+	}
+	detail.Age += int(time.Now().Unix() - mempoolSnapshot.readAt)
+	detail.FunctionArgs, detail.FunctionArgsError = nil, ""
+	// txs are in rank order, the ones after the last one paying the same
+	// rate pay less
+	lower := len(txs) - i - 1
+	for _, other := range txs[i+1:] {
+		if other.FeeRate < txs[i].FeeRate {
+			break
+		}
+		lower -= 1
+	}
+	detail.Percentile = float64(lower) / float64(len(txs)) * 100
+	return detail, true, nil
+}
+
+// MempoolBucket aggregates the mempool transactions calling the same contract
+// function, or of the same payload type for payloads without a contract
+type MempoolBucket struct {
+	Contract   string
+	Function   string
+	Count      int
+	TotalFees  int
+	AvgFeeRate float64
+	OldestAge  int
+	// Sum of transaction lengths, to compute AvgFeeRate
+	bytes int
+}
+
+type bucketKey struct {
+	category string
+	contract string
+	function string
+}
+
+// mempoolBreakdown buckets mempool transactions by payload category, then by
+// contract and function
+type mempoolBreakdown map[bucketKey]*MempoolBucket
+
+// payloadCategories are the categories payloadCategory returns
+var payloadCategories = []string{"transfer", "contract-call", "contract-deploy", "coinbase", "tenure-change", "other"}
+
+// payloadCategory groups payload types that only differ by version
+func payloadCategory(t codec.PayloadType) string {
+	switch t {
+	case codec.TokenTransfer:
+		return "transfer"
+	case codec.ContractCall:
+		return "contract-call"
+	case codec.ContractDeploy, codec.VersionedContractDeploy:
+		return "contract-deploy"
+	case codec.Coinbase, codec.CoinbaseToAltRecipient, codec.NakamotoCoinbase:
+		return "coinbase"
+	case codec.TenureChange:
+		return "tenure-change"
+	}
+	return "other"
+}
+
+func (b mempoolBreakdown) add(txn mempoolTxn, tx *codec.Transaction) {
+	key := bucketKey{payloadCategory(tx.Payload.Type), txContract(tx), txFunction(tx)}
+	bucket, exists := b[key]
+	if !exists {
+		bucket = &MempoolBucket{Contract: key.contract, Function: key.function}
+		b[key] = bucket
+	}
+	bucket.Count += 1
+	bucket.TotalFees += txn.TxFee
+	bucket.bytes += txn.Length
+	bucket.OldestAge = max(bucket.OldestAge, txn.Age)
+}
+
+// buckets returns the buckets of each payload category, busiest first
+func (b mempoolBreakdown) buckets() map[string][]MempoolBucket {
+	categories := make(map[string][]MempoolBucket)
+	for key, bucket := range b {
+		if bucket.bytes > 0 {
+			bucket.AvgFeeRate = float64(bucket.TotalFees) / float64(bucket.bytes)
+		}
+		categories[key.category] = append(categories[key.category], *bucket)
+	}
+	for _, buckets := range categories {
+		slices.SortFunc(buckets, func(i, j MempoolBucket) int {
+			// reverse the order to get descending
+			return cmp.Or(cmp.Compare(j.Count, i.Count), cmp.Compare(i.Contract+i.Function, j.Contract+j.Function))
+		})
+	}
+	return categories
+}
+
+// mempoolFilter selects mempool transactions from the query parameters of a
+// /mempool/txs request.
+type mempoolFilter struct {
+	sender      string
+	contract    string
+	function    string
+	payloadType string
+	minFee      int
+	maxFee      int
+	minAge      int
+	maxAge      int
+}
+
+func parseMempoolFilter(r *http.Request) (mempoolFilter, error) {
+	q := r.URL.Query()
+	f := mempoolFilter{
+		sender:      q.Get("sender"),
+		contract:    q.Get("contract"),
+		function:    q.Get("function"),
+		payloadType: q.Get("type"),
+	}
+	var err error
+	if f.minFee, err = intParam(r, "min_fee", 0); err != nil {
+		return f, err
+	}
+	if f.maxFee, err = intParam(r, "max_fee", -1); err != nil {
+		return f, err
+	}
+	if f.minAge, err = intParam(r, "min_age", 0); err != nil {
+		return f, err
+	}
+	if f.maxAge, err = intParam(r, "max_age", -1); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func (f mempoolFilter) match(tx MempoolTx) bool {
+	switch {
+	case f.sender != "" && tx.Sender != f.sender && tx.Sponsor != f.sender:
+		return false
+	case f.contract != "" && tx.Contract != f.contract:
+		return false
+	case f.function != "" && tx.Function != f.function:
+		return false
+	case f.payloadType != "" && !strings.EqualFold(tx.PayloadType, f.payloadType):
+		return false
+	case tx.Fee < f.minFee || (f.maxFee >= 0 && tx.Fee > f.maxFee):
+		return false
+	case tx.Age < f.minAge || (f.maxAge >= 0 && tx.Age > f.maxAge):
+		return false
+	}
+	return true
+}
+
+// sortMempoolTxs orders txs by the field named by sort, one of fee_rate, fee
+// or age, ascending if asc is set. txs are expected to be in rank order.
+func sortMempoolTxs(txs []MempoolTx, sort string, asc bool) bool {
+	var key func(MempoolTx) float64
+	switch sort {
+	case "", "fee_rate":
+		key = func(tx MempoolTx) float64 { return tx.FeeRate }
+	case "fee":
+		key = func(tx MempoolTx) float64 { return float64(tx.Fee) }
+	case "age":
+		key = func(tx MempoolTx) float64 { return float64(tx.Age) }
+	default:
+		return false
+	}
+	slices.SortStableFunc(txs, func(a, b MempoolTx) int {
+		if asc {
+			return cmp.Compare(key(a), key(b))
+		}
+		return cmp.Compare(key(b), key(a))
+	})
+	return true
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestRankMempool(t *testing.T) {
+	txs := []MempoolTx{
+		{Txid: "a", FeeRate: 1},
+		{Txid: "b", FeeRate: 3},
+		{Txid: "c", FeeRate: 2},
+		{Txid: "d", FeeRate: 3},
+		{Txid: "e", FeeRate: 0},
+	}
+	rankMempool(txs)
+	want := []struct {
+		txid string
+		rank int
+	}{{"b", 1}, {"d", 1}, {"c", 3}, {"a", 4}, {"e", 5}}
+	for i, w := range want {
+		if txs[i].Txid != w.txid || txs[i].Rank != w.rank {
+			t.Errorf("txs[%d] = %s ranked %d, want %s ranked %d", i, txs[i].Txid, txs[i].Rank, w.txid, w.rank)
+		}
+	}
+}
+
+func TestFindMempoolTx(t *testing.T) {
+	if _, _, err := findMempoolTx("a"); err == nil {
+		t.Errorf("findMempoolTx before the mempool is read: got no error")
+	}
+
+	txs := []MempoolTx{
+		{Txid: "a", FeeRate: 1},
+		{Txid: "b", FeeRate: 3},
+		{Txid: "c", FeeRate: 2},
+		{Txid: "d", FeeRate: 2},
+	}
+	setMempoolSnapshot(1, txs, map[string]Tx{})
+	defer setMempoolSnapshot(0, nil, nil)
+
+	tests := []struct {
+		txid       string
+		found      bool
+		rank       int
+		percentile float64
+	}{
+		{"b", true, 1, 75},
+		{"0xC", true, 2, 25},
+		{"d", true, 2, 25},
+		{"a", true, 4, 0},
+		{"e", false, 0, 0},
+	}
+	for _, tt := range tests {
+		detail, found, err := findMempoolTx(tt.txid)
+		if err != nil || found != tt.found {
+			t.Errorf("findMempoolTx(%q) found = %v, %v, want %v", tt.txid, found, err, tt.found)
+			continue
+		}
+		if found && (detail.Rank != tt.rank || detail.Percentile != tt.percentile || detail.MempoolSize != 4) {
+			t.Errorf("findMempoolTx(%q) = rank %d, percentile %v, size %d, want rank %d, percentile %v, size 4",
+				tt.txid, detail.Rank, detail.Percentile, detail.MempoolSize, tt.rank, tt.percentile)
+		}
+	}
+}
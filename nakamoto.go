@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Nakamoto blocks are only stored serialized, in the staging blocks database.
+// The codec package decodes a transaction from its start but doesn't consume
+// every byte of some payloads (contract call arguments, transfer memos,
+// Nakamoto coinbase recipients...), so transactions inside a block are
+// delimited by walking the wire format here instead.
+
+type NakamotoBlockHeader struct {
+	Version          uint8
+	ChainLength      uint64
+	BurnSpent        uint64
+	ConsensusHash    string
+	ParentBlockId    string
+	TxMerkleRoot     string
+	StateIndexRoot   string
+	Timestamp        uint64
+	MinerSignature   string
+	SignerSignatures []string
+}
+
+type nakamotoBlock struct {
+	Header NakamotoBlockHeader
+	// Serialized transactions, in block order
+	Txs [][]byte
+}
+
+// txid is the hash of a serialized transaction, as used by the node
+func txid(raw []byte) string {
+	sum := sha512.Sum512_256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func readHex(r *bytes.Reader, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func skipBytes(r *bytes.Reader, n int64) error {
+	if int64(r.Len()) < n {
+		return io.ErrUnexpectedEOF
+	}
+	_, err := r.Seek(n, io.SeekCurrent)
+	return err
+}
+
+// skipPrefixed skips a byte string prefixed by its length, as a big endian
+// integer of lenSize bytes.
+func skipPrefixed(r *bytes.Reader, lenSize int) error {
+	var n int64
+	switch lenSize {
+	case 1:
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		n = int64(b)
+	case 4:
+		var l uint32
+		if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+			return err
+		}
+		n = int64(l)
+	}
+	return skipBytes(r, n)
+}
+
+// skipClarityValue skips a consensus serialized Clarity value
+func skipClarityValue(r *bytes.Reader) error {
+	typeID, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch typeID {
+	case 0x00, 0x01:
+		// (u)int128
+		return skipBytes(r, 16)
+	case 0x02, 0x0d, 0x0e:
+		// buffer, string-ascii, string-utf8
+		return skipPrefixed(r, 4)
+	case 0x03, 0x04, 0x09:
+		// true, false, none
+		return nil
+	case 0x05:
+		return skipBytes(r, 21)
+	case 0x06:
+		if err := skipBytes(r, 21); err != nil {
+			return err
+		}
+		return skipPrefixed(r, 1)
+	case 0x07, 0x08, 0x0a:
+		// ok, err, some
+		return skipClarityValue(r)
+	case 0x0b, 0x0c:
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return err
+		}
+		for i := uint32(0); i < n; i++ {
+			if typeID == 0x0c {
+				if err := skipPrefixed(r, 1); err != nil {
+					return err
+				}
+			}
+			if err := skipClarityValue(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown clarity type %#x", typeID)
+}
+
+func skipSpendingCondition(r *bytes.Reader) error {
+	hashMode, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	// signer, nonce and fee
+	if err := skipBytes(r, 20+8+8); err != nil {
+		return err
+	}
+	switch hashMode {
+	case 0x00, 0x02:
+		// key encoding and signature
+		return skipBytes(r, 1+65)
+	case 0x01, 0x03, 0x05, 0x07:
+		var fields uint32
+		if err := binary.Read(r, binary.BigEndian, &fields); err != nil {
+			return err
+		}
+		for i := uint32(0); i < fields; i++ {
+			fieldID, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			// compressed or uncompressed public key, or signature
+			size := int64(65)
+			if fieldID == 0x00 || fieldID == 0x01 {
+				size = 33
+			}
+			if err := skipBytes(r, size); err != nil {
+				return err
+			}
+		}
+		// signatures required
+		return skipBytes(r, 2)
+	}
+	return fmt.Errorf("unknown hash mode %#x", hashMode)
+}
+
+func skipPostCondition(r *bytes.Reader) error {
+	pcType, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	principal, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch principal {
+	case 0x01:
+		// origin
+	case 0x02:
+		err = skipBytes(r, 21)
+	case 0x03:
+		if err = skipBytes(r, 21); err == nil {
+			err = skipPrefixed(r, 1)
+		}
+	default:
+		err = fmt.Errorf("unknown post condition principal %#x", principal)
+	}
+	if err != nil {
+		return err
+	}
+
+	if pcType == 0x00 {
+		// condition code and amount
+		return skipBytes(r, 1+8)
+	}
+	// asset info: address, contract name and asset name
+	if err := skipBytes(r, 21); err != nil {
+		return err
+	}
+	if err := skipPrefixed(r, 1); err != nil {
+		return err
+	}
+	if err := skipPrefixed(r, 1); err != nil {
+		return err
+	}
+	switch pcType {
+	case 0x01:
+		return skipBytes(r, 1+8)
+	case 0x02:
+		if err := skipClarityValue(r); err != nil {
+			return err
+		}
+		return skipBytes(r, 1)
+	}
+	return fmt.Errorf("unknown post condition type %#x", pcType)
+}
+
+func skipPayload(r *bytes.Reader) error {
+	payloadType, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch payloadType {
+	case 0x00:
+		// recipient, amount and memo
+		if err := skipClarityValue(r); err != nil {
+			return err
+		}
+		return skipBytes(r, 8+34)
+	case 0x01, 0x06:
+		if payloadType == 0x06 {
+			// clarity version
+			if err := skipBytes(r, 1); err != nil {
+				return err
+			}
+		}
+		if err := skipPrefixed(r, 1); err != nil {
+			return err
+		}
+		return skipPrefixed(r, 4)
+	case 0x02:
+		// contract address, contract name and function name
+		if err := skipBytes(r, 21); err != nil {
+			return err
+		}
+		if err := skipPrefixed(r, 1); err != nil {
+			return err
+		}
+		if err := skipPrefixed(r, 1); err != nil {
+			return err
+		}
+		var args uint32
+		if err := binary.Read(r, binary.BigEndian, &args); err != nil {
+			return err
+		}
+		for i := uint32(0); i < args; i++ {
+			if err := skipClarityValue(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case 0x03:
+		// two microblock headers
+		return skipBytes(r, 2*(1+2+32+32+65))
+	case 0x04:
+		return skipBytes(r, 32)
+	case 0x05:
+		if err := skipBytes(r, 32); err != nil {
+			return err
+		}
+		return skipClarityValue(r)
+	case 0x07:
+		// consensus hashes, previous tenure end and blocks, cause and
+		// pubkey hash
+		return skipBytes(r, 20+20+20+32+4+1+20)
+	case 0x08:
+		// buffer, optional recipient and VRF proof
+		if err := skipBytes(r, 32); err != nil {
+			return err
+		}
+		if err := skipClarityValue(r); err != nil {
+			return err
+		}
+		return skipBytes(r, 80)
+	}
+	return fmt.Errorf("unknown payload type %#x", payloadType)
+}
+
+// skipToPayload skips a serialized transaction up to its payload
+func skipToPayload(r *bytes.Reader) error {
+	// version and chain id
+	if err := skipBytes(r, 1+4); err != nil {
+		return err
+	}
+	authType, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if err := skipSpendingCondition(r); err != nil {
+		return err
+	}
+	if authType == 0x05 {
+		if err := skipSpendingCondition(r); err != nil {
+			return err
+		}
+	}
+	// anchor mode and post condition mode
+	if err := skipBytes(r, 2); err != nil {
+		return err
+	}
+	var pcCount uint32
+	if err := binary.Read(r, binary.BigEndian, &pcCount); err != nil {
+		return err
+	}
+	for i := uint32(0); i < pcCount; i++ {
+		if err := skipPostCondition(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipTx skips a serialized transaction
+func skipTx(r *bytes.Reader) error {
+	if err := skipToPayload(r); err != nil {
+		return err
+	}
+	return skipPayload(r)
+}
+
+// txLength returns the length of the transaction at the start of data
+func txLength(data []byte) (int, error) {
+	r := bytes.NewReader(data)
+	if err := skipTx(r); err != nil {
+		return 0, err
+	}
+	return len(data) - r.Len(), nil
+}
+
+// parseNakamotoBlock splits a serialized Nakamoto block into its header and
+// serialized transactions.
+func parseNakamotoBlock(data []byte) (nakamotoBlock, error) {
+	var b nakamotoBlock
+	h := &b.Header
+	r := bytes.NewReader(data)
+
+	var err error
+	if h.Version, err = r.ReadByte(); err != nil {
+		return b, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &h.ChainLength); err != nil {
+		return b, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &h.BurnSpent); err != nil {
+		return b, err
+	}
+	for _, field := range []struct {
+		dest *string
+		size int
+	}{
+		{&h.ConsensusHash, 20},
+		{&h.ParentBlockId, 32},
+		{&h.TxMerkleRoot, 32},
+		{&h.StateIndexRoot, 32},
+	} {
+		if *field.dest, err = readHex(r, field.size); err != nil {
+			return b, err
+		}
+	}
+	if err := binary.Read(r, binary.BigEndian, &h.Timestamp); err != nil {
+		return b, err
+	}
+	if h.MinerSignature, err = readHex(r, 65); err != nil {
+		return b, err
+	}
+	var signatures uint32
+	if err := binary.Read(r, binary.BigEndian, &signatures); err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < signatures; i++ {
+		sig, err := readHex(r, 65)
+		if err != nil {
+			return b, err
+		}
+		h.SignerSignatures = append(h.SignerSignatures, sig)
+	}
+	// PoX treatment bitvec: bit length, then the bytes
+	if err := skipBytes(r, 2); err != nil {
+		return b, err
+	}
+	if err := skipPrefixed(r, 4); err != nil {
+		return b, err
+	}
+
+	var txCount uint32
+	if err := binary.Read(r, binary.BigEndian, &txCount); err != nil {
+		return b, err
+	}
+	for i := uint32(0); i < txCount; i++ {
+		offset := len(data) - r.Len()
+		n, err := txLength(data[offset:])
+		if err != nil {
+			return b, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		b.Txs = append(b.Txs, data[offset:offset+n])
+		if err := skipBytes(r, int64(n)); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
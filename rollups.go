@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	ResolutionRaw  = "raw"
+	ResolutionHour = "hour"
+	ResolutionDay  = "day"
+
+	defaultMempoolSizeRange = 2 * time.Hour
+	maxMempoolSizeRange     = 365 * 24 * time.Hour
+)
+
+// How long pruneTask keeps the mempool history of each resolution. Daily
+// rollups are kept for good.
+var resolutionRetention = map[string]time.Duration{
+	ResolutionRaw:  2 * 24 * time.Hour,
+	ResolutionHour: 90 * 24 * time.Hour,
+	ResolutionDay:  maxMempoolSizeRange,
+}
+
+// strftime formats truncating a timestamp to the start of its rollup bucket
+var rollupFormats = map[string]string{
+	ResolutionHour: "%Y-%m-%d %H:00:00",
+	ResolutionDay:  "%Y-%m-%d 00:00:00",
+}
+
+// MempoolRollup summarizes the mempool snapshots of an hour or a day.
+// FeeRates averages the fee rate quantiles of the snapshots.
+type MempoolRollup struct {
+	Timestamp time.Time
+	Samples   int
+	MinCount  int
+	MaxCount  int
+	AvgCount  float64
+	FeeRates  FeeRates
+}
+
+// rollupMempoolStats summarizes mempool_stats into hourly and daily rollups.
+// The latest bucket of each resolution is recomputed as it was likely still
+// filling up, so this can run as often as needed.
+func rollupMempoolStats(hubDb *sqlx.DB) error {
+	tx := hubDb.MustBegin()
+	defer tx.Rollback()
+
+	for resolution, format := range rollupFormats {
+		var from string
+		err := tx.Get(&from,
+			"SELECT COALESCE(MAX(timestamp), '') FROM mempool_rollups WHERE resolution = ?", resolution)
+		if err != nil {
+			return err
+		}
+
+		var snapshots []struct {
+			Bucket string `db:"bucket"`
+			Count  int    `db:"count"`
+			Data   []byte `db:"data"`
+		}
+		err = tx.Select(&snapshots,
+			"SELECT strftime(?, timestamp) AS bucket, count, data FROM mempool_stats WHERE timestamp >= ? ORDER BY timestamp",
+			format, from)
+		if err != nil {
+			return err
+		}
+
+		rollups := make(map[string]*MempoolRollup)
+		feeSamples := make(map[string]int)
+		for _, s := range snapshots {
+			rollup, exists := rollups[s.Bucket]
+			if !exists {
+				rollup = &MempoolRollup{MinCount: math.MaxInt}
+				rollups[s.Bucket] = rollup
+			}
+			rollup.Samples += 1
+			rollup.MinCount = min(rollup.MinCount, s.Count)
+			rollup.MaxCount = max(rollup.MaxCount, s.Count)
+			rollup.AvgCount += float64(s.Count)
+
+			// Snapshots from before fee rates were recorded only count
+			// towards the size
+			var d MempoolData
+			if err := json.Unmarshal(s.Data, &d); err != nil || d.FeeRates == (FeeRates{}) {
+				continue
+			}
+			feeSamples[s.Bucket] += 1
+			rollup.FeeRates.Low += d.FeeRates.Low
+			rollup.FeeRates.Medium += d.FeeRates.Medium
+			rollup.FeeRates.High += d.FeeRates.High
+		}
+
+		for bucket, rollup := range rollups {
+			rollup.AvgCount /= float64(rollup.Samples)
+			if n := float64(feeSamples[bucket]); n > 0 {
+				rollup.FeeRates.Low /= n
+				rollup.FeeRates.Medium /= n
+				rollup.FeeRates.High /= n
+			}
+			_, err := tx.Exec(`
+			INSERT OR REPLACE INTO mempool_rollups
+			(resolution, timestamp, samples, min_count, max_count, avg_count, fee_rate_low, fee_rate_medium, fee_rate_high)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				resolution, bucket, rollup.Samples, rollup.MinCount, rollup.MaxCount, rollup.AvgCount,
+				rollup.FeeRates.Low, rollup.FeeRates.Medium, rollup.FeeRates.High)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func mempoolRollupTask() error {
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite"))
+	defer hubDb.Close()
+
+	return rollupMempoolStats(hubDb)
+}
+
+// getMempoolRollups returns the rollups of resolution since the given time,
+// latest first.
+func getMempoolRollups(hubDb *sqlx.DB, resolution string, since time.Time) ([]MempoolRollup, error) {
+	var rows []struct {
+		Timestamp     time.Time `db:"timestamp"`
+		Samples       int       `db:"samples"`
+		MinCount      int       `db:"min_count"`
+		MaxCount      int       `db:"max_count"`
+		AvgCount      float64   `db:"avg_count"`
+		FeeRateLow    float64   `db:"fee_rate_low"`
+		FeeRateMedium float64   `db:"fee_rate_medium"`
+		FeeRateHigh   float64   `db:"fee_rate_high"`
+	}
+	err := hubDb.Select(&rows, `
+	SELECT timestamp, samples, min_count, max_count, avg_count, fee_rate_low, fee_rate_medium, fee_rate_high
+	FROM mempool_rollups
+	WHERE resolution = ? AND timestamp >= ?
+	ORDER BY timestamp DESC`,
+		resolution, since.UTC().Format(time.DateTime))
+	rollups := make([]MempoolRollup, len(rows))
+	for i, r := range rows {
+		rollups[i] = MempoolRollup{
+			Timestamp: r.Timestamp,
+			Samples:   r.Samples,
+			MinCount:  r.MinCount,
+			MaxCount:  r.MaxCount,
+			AvgCount:  r.AvgCount,
+			FeeRates:  FeeRates{r.FeeRateLow, r.FeeRateMedium, r.FeeRateHigh},
+		}
+	}
+	return rollups, err
+}
+
+// parseRange parses a duration, also accepting a number of days (7d) or
+// weeks (2w).
+func parseRange(s string) (time.Duration, error) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid range: %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// defaultResolution picks a resolution giving a reasonable number of points
+// over period
+func defaultResolution(period time.Duration) string {
+	switch {
+	case period <= resolutionRetention[ResolutionRaw]:
+		return ResolutionRaw
+	case period <= 60*24*time.Hour:
+		return ResolutionHour
+	}
+	return ResolutionDay
+}
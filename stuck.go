@@ -0,0 +1,146 @@
+package main
+
+import (
+	"cmp"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// A nonce is missing between two of the account's mempool transactions
+	StuckNonceGap = "nonce-gap"
+	// The account's lowest nonce transaction has been waiting too long
+	StuckTooOld = "too-old"
+
+	defaultStuckBurnBlocks = 6
+	// The node drops transactions after 256 blocks
+	maxStuckBurnBlocks = 256
+)
+
+// StuckChain is a chain of mempool transactions from one account that can't
+// be mined until the blocking nonce is: either it is missing from the
+// mempool, or it has been waiting for too long, likely with a low fee.
+type StuckChain struct {
+	Sender        string
+	Reason        string
+	BlockingNonce uint64
+	OldestAge     int
+	// Blocked transactions, in nonce order
+	Transactions []MempoolTx
+}
+
+// burnBlockAge returns how long ago, in seconds, the Bitcoin block mined n
+// blocks before the tip was.
+func burnBlockAge(n int) (int, error) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, sortitionDb))
+	defer db.Close()
+
+	var timestamp int64
+	err := db.Get(&timestamp,
+		"SELECT burn_header_timestamp FROM snapshots WHERE pox_valid = 1 ORDER BY block_height DESC LIMIT 1 OFFSET ?",
+		n)
+	if err != nil {
+		return 0, err
+	}
+	return int(time.Now().Unix() - timestamp), nil
+}
+
+// accountNonces returns the next nonce of the accounts sending mempool
+// transactions, as cached by the node in its mempool database. Accounts the
+// node has no cached nonce for are left out.
+func accountNonces() (map[string]uint64, error) {
+	mdb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, mempoolDb))
+	defer mdb.Close()
+
+	rows := []struct {
+		Address string `db:"address"`
+		Nonce   uint64 `db:"nonce"`
+	}{}
+	err := mdb.Select(&rows,
+		"SELECT address, nonce FROM nonces WHERE address IN (SELECT origin_address FROM mempool)")
+	if err != nil {
+		return nil, err
+	}
+	nonces := make(map[string]uint64, len(rows))
+	for _, row := range rows {
+		nonces[row.Address] = row.Nonce
+	}
+	return nonces, nil
+}
+
+// findStuckChains groups the mempool transactions by sender and returns the
+// chains that are blocked, oldest first. nonces are the next nonces of the
+// accounts, see accountNonces. A chain has a nonce gap if its lowest nonce is
+// above the account's next nonce, or if a nonce is missing between two of its
+// transactions. Separately, the transactions before any gap are too old if
+// the lowest nonce one has been in the mempool for more than maxAge seconds.
+func findStuckChains(txs []MempoolTx, nonces map[string]uint64, maxAge int) []StuckChain {
+	bySender := make(map[string][]MempoolTx)
+	for _, tx := range txs {
+		bySender[tx.Sender] = append(bySender[tx.Sender], tx)
+	}
+
+	chains := []StuckChain{}
+	for sender, pending := range bySender {
+		slices.SortFunc(pending, func(a, b MempoolTx) int {
+			return cmp.Compare(a.Nonce, b.Nonce)
+		})
+		next, hasNext := nonces[sender]
+		// Nonces below the account's were already used, they can't be mined
+		pending = slices.DeleteFunc(pending, func(tx MempoolTx) bool {
+			return hasNext && tx.Nonce < next
+		})
+		if len(pending) == 0 {
+			continue
+		}
+
+		found := []StuckChain{}
+		if hasNext && pending[0].Nonce > next {
+			// Nothing can be mined until the missing nonce is, however old
+			found = append(found, StuckChain{
+				Sender:        sender,
+				Reason:        StuckNonceGap,
+				BlockingNonce: next,
+				Transactions:  pending,
+			})
+			pending = nil
+		} else {
+			for i := 1; i < len(pending); i++ {
+				if pending[i].Nonce > pending[i-1].Nonce+1 {
+					found = append(found, StuckChain{
+						Sender:        sender,
+						Reason:        StuckNonceGap,
+						BlockingNonce: pending[i-1].Nonce + 1,
+						Transactions:  pending[i:],
+					})
+					pending = pending[:i]
+					break
+				}
+			}
+		}
+		if len(pending) > 0 && pending[0].Age > maxAge {
+			found = append(found, StuckChain{
+				Sender:        sender,
+				Reason:        StuckTooOld,
+				BlockingNonce: pending[0].Nonce,
+				Transactions:  pending,
+			})
+		}
+		for _, chain := range found {
+			for _, tx := range chain.Transactions {
+				chain.OldestAge = max(chain.OldestAge, tx.Age)
+			}
+			chains = append(chains, chain)
+		}
+	}
+
+	slices.SortFunc(chains, func(a, b StuckChain) int {
+		// reverse the order to get descending
+		return cmp.Or(cmp.Compare(b.OldestAge, a.OldestAge), cmp.Compare(a.Sender, b.Sender),
+			cmp.Compare(a.BlockingNonce, b.BlockingNonce))
+	})
+	return chains
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindStuckChains(t *testing.T) {
+	const maxAge = 100
+	tx := func(sender string, nonce uint64, age int) MempoolTx {
+		return MempoolTx{Sender: sender, Nonce: nonce, Age: age}
+	}
+	type chain struct {
+		reason   string
+		blocking uint64
+		nonces   []uint64
+	}
+	tests := []struct {
+		name   string
+		txs    []MempoolTx
+		nonces map[string]uint64
+		want   []chain
+	}{
+		{
+			name: "contiguous and recent",
+			txs:  []MempoolTx{tx("A", 5, 10), tx("A", 6, 10)},
+			want: nil,
+		},
+		{
+			name:   "next nonce in the mempool",
+			txs:    []MempoolTx{tx("A", 5, 10), tx("A", 6, 10)},
+			nonces: map[string]uint64{"A": 5},
+			want:   nil,
+		},
+		{
+			name:   "gap before the lowest nonce",
+			txs:    []MempoolTx{tx("A", 7, 10), tx("A", 8, 10)},
+			nonces: map[string]uint64{"A": 5},
+			want:   []chain{{StuckNonceGap, 5, []uint64{7, 8}}},
+		},
+		{
+			name:   "gap before an old lowest nonce",
+			txs:    []MempoolTx{tx("A", 7, 500)},
+			nonces: map[string]uint64{"A": 5},
+			want:   []chain{{StuckNonceGap, 5, []uint64{7}}},
+		},
+		{
+			name:   "already used nonces",
+			txs:    []MempoolTx{tx("A", 3, 500), tx("A", 5, 10)},
+			nonces: map[string]uint64{"A": 5},
+			want:   nil,
+		},
+		{
+			name: "gap between mempool nonces",
+			txs:  []MempoolTx{tx("A", 5, 10), tx("A", 8, 20), tx("A", 9, 30)},
+			want: []chain{{StuckNonceGap, 6, []uint64{8, 9}}},
+		},
+		{
+			name: "old lowest nonce",
+			txs:  []MempoolTx{tx("A", 6, 10), tx("A", 5, 200)},
+			want: []chain{{StuckTooOld, 5, []uint64{5, 6}}},
+		},
+		{
+			name: "old lowest nonce and a gap",
+			txs:  []MempoolTx{tx("A", 5, 200), tx("A", 6, 10), tx("A", 9, 20)},
+			want: []chain{{StuckTooOld, 5, []uint64{5, 6}}, {StuckNonceGap, 7, []uint64{9}}},
+		},
+		{
+			name: "oldest first",
+			txs:  []MempoolTx{tx("A", 5, 200), tx("B", 1, 300), tx("C", 1, 10)},
+			want: []chain{{StuckTooOld, 1, []uint64{1}}, {StuckTooOld, 5, []uint64{5}}},
+		},
+	}
+	for _, tt := range tests {
+		got := findStuckChains(tt.txs, tt.nonces, maxAge)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d chains, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			nonces := []uint64{}
+			for _, tx := range got[i].Transactions {
+				nonces = append(nonces, tx.Nonce)
+			}
+			if got[i].Reason != want.reason || got[i].BlockingNonce != want.blocking || !slices.Equal(nonces, want.nonces) {
+				t.Errorf("%s: chain %d = %s blocked by %d with nonces %v, want %s blocked by %d with nonces %v",
+					tt.name, i, got[i].Reason, got[i].BlockingNonce, nonces, want.reason, want.blocking, want.nonces)
+			}
+		}
+	}
+}
@@ -1,15 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"cmp"
 	"encoding/binary"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
+	"math"
 	"net/http"
 	"path/filepath"
 	"slices"
@@ -19,7 +18,6 @@ import (
 	"github.com/HdrHistogram/hdrhistogram-go"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/stxpub/codec"
 	"github.com/tidwall/gjson"
 )
 
@@ -111,14 +109,10 @@ type miner struct {
 	WinRate         float32
 }
 
-func queryMinerPower() []miner {
-	const numBlocks = 144
-
-	db, cdb := openDatabases()
-	defer db.Close()
-	defer cdb.Close()
-
-	_, lowerBound := getBlockRange(db, numBlocks)
+// queryMinerPower computes per miner statistics for the burn blocks in
+// (lowerBound, upperBound].
+func queryMinerPower(db *sqlx.DB, cdb *sqlx.DB, lowerBound, upperBound int) []miner {
+	numBlocks := uint(upperBound - lowerBound)
 
 	query := `WITH RECURSIVE block_ancestors(burn_header_height,parent_block_id,address,burnchain_commit_burn,stx_reward)
 	AS (
@@ -129,18 +123,23 @@ func queryMinerPower() []miner {
 	JOIN payments
 		ON nakamoto_block_headers.index_block_hash = payments.index_block_hash
 		WHERE nakamoto_block_headers.tenure_changed = 1
+			AND nakamoto_block_headers.burn_header_height > ? AND nakamoto_block_headers.burn_header_height <= ?
 	UNION ALL
 	SELECT
 		nakamoto_block_headers.burn_header_height,nakamoto_block_headers.parent_block_id,
 		payments.recipient,payments.burnchain_commit_burn,(payments.coinbase + payments.tx_fees_anchored + payments.tx_fees_streamed) AS stx_reward
 	FROM (nakamoto_block_headers JOIN payments ON nakamoto_block_headers.index_block_hash = payments.index_block_hash)
 	JOIN block_ancestors ON nakamoto_block_headers.index_block_hash = block_ancestors.parent_block_id
+	WHERE nakamoto_block_headers.burn_header_height > ?
 	ORDER BY nakamoto_block_headers.burn_header_height DESC
 	)
     SELECT block_ancestors.burn_header_height,block_ancestors.address,block_ancestors.burnchain_commit_burn,block_ancestors.stx_reward
     FROM block_ancestors LIMIT ?`
 
-	rows, err := cdb.Query(query, numBlocks)
+	// Rows come out one tenure at a time, newest first, so the window takes
+	// at most one row per burn block. The walk stops at lowerBound rather than
+	// going down the whole chain.
+	rows, err := cdb.Query(query, lowerBound, upperBound, lowerBound, upperBound-lowerBound)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -160,7 +159,7 @@ func queryMinerPower() []miner {
 		}
 		slog.Debug("Processing", "burnHeight", burnHeight, "address", address, "commitBurn", commitBurn,
 			"stxReward", stxReward, "lowerBound", lowerBound)
-		if burnHeight <= lowerBound {
+		if burnHeight <= lowerBound || burnHeight > upperBound {
 			continue
 		}
 		addrCounts[address] += 1
@@ -183,13 +182,14 @@ func queryMinerPower() []miner {
 	FROM (
 	    SELECT TRIM(apparent_sender,'"') AS sender, burn_fee
 	    FROM block_commits
-	    WHERE block_height > ?
+	    WHERE block_height > ? AND block_height <= ?
 	) GROUP BY sender`
-	r2, err := db.Query(query, lowerBound)
+	r2, err := db.Query(query, lowerBound, upperBound)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer r2.Close()
+	overwritten := make(map[string]bool)
 	for r2.Next() {
 		// this is a bitcoin address but btcSpent map is keyed by stacks address
 		var sender string
@@ -197,17 +197,18 @@ func queryMinerPower() []miner {
 		if err := r2.Scan(&sender, &burnFee); err != nil {
 			log.Fatal(err)
 		}
-		// Overwrite btcSpent for burnFee for now
-		// Iterate over minerAddressMap. If the value matches the sender, update btcSpent
-		minerAddressMap.Range(func(k, v any) bool {
-			if v == sender {
-				addr := k.(string)
+		// Overwrite btcSpent for burnFee for now, summing over all the
+		// Bitcoin addresses that pay out to the same STX address
+		if v, ok := minerSenderMap.Load(sender); ok {
+			addr := v.(string)
+			if overwritten[addr] {
+				btcSpent[addr] += burnFee
+			} else {
 				btcSpent[addr] = burnFee
-				slog.Debug("Updating btc spent", "btc", sender, "stx", addr, "btc", burnFee)
-				return false
+				overwritten[addr] = true
 			}
-			return true
-		})
+			slog.Debug("Updating btc spent", "btc", sender, "stx", addr, "btc", burnFee)
+		}
 	}
 
 	slog.Debug("Miner power", "addrCounts", addrCounts, "btcSpent", btcSpent,
@@ -225,7 +226,7 @@ func queryMinerPower() []miner {
 			BlocksWon:       won,
 			BtcSpent:        btcSpent[addr],
 			StxEarnt:        float32(stxEarnt[addr]) / 1_000_000,
-			WinRate:         (float32(won) / numBlocks) * 100,
+			WinRate:         (float32(won) / float32(numBlocks)) * 100,
 		}
 		miners = append(miners, m)
 	}
@@ -237,7 +238,159 @@ func queryMinerPower() []miner {
 	return miners
 }
 
-func fetchCommitData(db *sqlx.DB, lower_bound_height, start_block int) BlockCommits {
+// MinerCommit is a single block commit made by a miner
+type MinerCommit struct {
+	Txid            string
+	BurnBlockHeight int
+	Spend           int
+	SortitionSpend  int
+	Memo            string
+	Won             bool
+	Canonical       bool
+	Tip             bool
+	StacksHeight    int
+	BlockHash       string
+	CoinbaseEarned  int
+	FeesEarned      int
+	// Parent commit, empty if it is outside the window
+	Parent                string
+	ParentSender          string
+	ParentBurnBlockHeight int
+	ParentWon             bool
+	// Set when the parent is not in the previous burn block with commits
+	MissedParent bool
+}
+
+type MinerDetail struct {
+	StacksRecipient string
+	// Most recently seen Bitcoin address, and every one known to pay out to
+	// StacksRecipient
+	BitcoinAddress   string
+	BitcoinAddresses []string
+	FromHeight       int
+	ToHeight         int
+	BlocksCommitted  uint
+	BlocksWon        uint
+	BtcSpent         uint
+	StxEarnt         float32
+	WinRate          float32
+	// Number of commits chained to one of the miner's own commits
+	SelfParented uint
+	// Number of commits whose parent skipped the previous burn block
+	MissedParents uint
+	// Number of commits per memo value
+	Memos   map[string]uint
+	Commits []MinerCommit
+}
+
+// resolveMinerAddress maps either a Stacks recipient or a Bitcoin sender to
+// the pair of addresses known for that miner. Either may be empty. The last
+// return value is false if address is unknown and not a valid address.
+func resolveMinerAddress(address string) (string, string, bool) {
+	if v, ok := minerAddressMap.Load(address); ok {
+		return address, v.(string), true
+	}
+	stxAddr := ""
+	if v, ok := minerSenderMap.Load(address); ok {
+		stxAddr = v.(string)
+	}
+	if stxAddr != "" {
+		return stxAddr, address, true
+	}
+	if _, ok := parseStacksAddress(address); ok {
+		// Stacks address we have no Bitcoin address for
+		return address, "", true
+	}
+	return "", address, validBitcoinAddress(address)
+}
+
+// queryMinerDetail collects the block commits made by the miner from any of
+// the Bitcoin addresses btcAddrs in the burn blocks (lowerBound, upperBound].
+func queryMinerDetail(db *sqlx.DB, cdb *sqlx.DB, stxAddr string, btcAddrs []string, lowerBound, upperBound int) (MinerDetail, error) {
+	blockCommits, err := collectBlockCommits(db, cdb, lowerBound+1, upperBound)
+	if err != nil {
+		return MinerDetail{}, err
+	}
+
+	detail := MinerDetail{
+		StacksRecipient:  stxAddr,
+		BitcoinAddress:   btcAddrs[0],
+		BitcoinAddresses: btcAddrs,
+		FromHeight:       lowerBound + 1,
+		ToHeight:         upperBound,
+		Memos:            make(map[string]uint),
+		Commits:          []MinerCommit{},
+	}
+	var stxEarnt int
+	last_height := 0
+	for block_height := lowerBound + 1; block_height <= upperBound; block_height++ {
+		block_commits, exists := blockCommits.CommitsByBlock[block_height]
+		if !exists {
+			continue
+		}
+		for _, commit := range block_commits {
+			if !slices.Contains(btcAddrs, strings.Trim(commit.sender, `"`)) {
+				continue
+			}
+			c := MinerCommit{
+				Txid:                  commit.txid,
+				BurnBlockHeight:       commit.burnBlockHeight,
+				Spend:                 commit.spend,
+				SortitionSpend:        blockCommits.SortitionFeesMap[commit.sortitionId],
+				Memo:                  commit.memo,
+				Won:                   commit.won,
+				Canonical:             commit.canonical,
+				Tip:                   commit.tip,
+				StacksHeight:          commit.stacksHeight,
+				BlockHash:             commit.blockHash,
+				CoinbaseEarned:        commit.coinbaseEarned,
+				FeesEarned:            commit.feesEarned,
+				Parent:                commit.parent,
+				ParentBurnBlockHeight: commit.parentBlockPtr,
+			}
+			if parent, exists := blockCommits.AllCommits[commit.parent]; exists {
+				c.ParentSender = strings.Trim(parent.sender, `"`)
+				c.ParentWon = parent.won
+				c.MissedParent = parentMissed(parent, last_height)
+				if slices.Contains(btcAddrs, c.ParentSender) {
+					detail.SelfParented += 1
+				}
+				if c.MissedParent {
+					detail.MissedParents += 1
+				}
+			}
+
+			detail.BlocksCommitted += 1
+			detail.BtcSpent += uint(commit.spend)
+			detail.Memos[commit.memo] += 1
+			if commit.won {
+				detail.BlocksWon += 1
+				stxEarnt += commit.coinbaseEarned + commit.feesEarned
+			}
+			detail.Commits = append(detail.Commits, c)
+		}
+		last_height = block_height
+	}
+	detail.StxEarnt = float32(stxEarnt) / 1_000_000
+	detail.WinRate = (float32(detail.BlocksWon) / float32(upperBound-lowerBound)) * 100
+	return detail, nil
+}
+
+// collectBlockCommits gathers the block commits in the burn blocks
+// [lower_bound_height, start_block] and marks the winners and canonical chain.
+func collectBlockCommits(db *sqlx.DB, cdb *sqlx.DB, lower_bound_height, start_block int) (BlockCommits, error) {
+	blockCommits, err := fetchCommitData(db, lower_bound_height, start_block)
+	if err != nil {
+		return blockCommits, err
+	}
+	if err := processWinningBlocks(db, cdb, lower_bound_height, start_block, blockCommits); err != nil {
+		return blockCommits, err
+	}
+	err = processCanonicalTip(db, start_block, blockCommits.AllCommits)
+	return blockCommits, err
+}
+
+func fetchCommitData(db *sqlx.DB, lower_bound_height, start_block int) (BlockCommits, error) {
 	sortitionFeesMap := make(map[string]int)
 	allCommits := make(map[string]*BlockCommit)
 	commitsByBlock := make(map[int][]*BlockCommit)
@@ -264,7 +417,7 @@ func fetchCommitData(db *sqlx.DB, lower_bound_height, start_block int) BlockComm
 
 	rows, err := db.Query(query, lower_bound_height, start_block)
 	if err != nil {
-		log.Fatal(err)
+		return BlockCommits{}, err
 	}
 	defer rows.Close()
 
@@ -281,7 +434,7 @@ func fetchCommitData(db *sqlx.DB, lower_bound_height, start_block int) BlockComm
 			&commit.parentBlockPtr,
 			&commit.parentVtxindex,
 			&commit.memo); err != nil {
-			log.Fatal(err)
+			return BlockCommits{}, err
 		}
 		commit.key = hashkey{commit.burnBlockHeight, commit.vtxindex}
 		commit.parentKey = hashkey{commit.parentBlockPtr, commit.parentVtxindex}
@@ -295,7 +448,7 @@ func fetchCommitData(db *sqlx.DB, lower_bound_height, start_block int) BlockComm
 	}
 
 	if !rows.NextResultSet() && rows.Err() != nil {
-		log.Fatalf("expected more result sets: %v", rows.Err())
+		return BlockCommits{}, fmt.Errorf("expected more result sets: %w", rows.Err())
 	}
 
 	// Now that we have all the commits, group them by block
@@ -312,10 +465,10 @@ func fetchCommitData(db *sqlx.DB, lower_bound_height, start_block int) BlockComm
 		SortitionFeesMap: sortitionFeesMap,
 		AllCommits:       allCommits,
 		CommitsByBlock:   commitsByBlock,
-	}
+	}, nil
 }
 
-func processWinningBlocks(db *sqlx.DB, cdb *sqlx.DB, lower_bound_height, start_block int, blockCommits BlockCommits) {
+func processWinningBlocks(db *sqlx.DB, cdb *sqlx.DB, lower_bound_height, start_block int, blockCommits BlockCommits) error {
 	commits := blockCommits.AllCommits
 	blockCommitsMap := blockCommits.CommitsByBlock
 
@@ -326,7 +479,7 @@ func processWinningBlocks(db *sqlx.DB, cdb *sqlx.DB, lower_bound_height, start_b
 		row := db.QueryRow("SELECT winning_block_txid, canonical_stacks_tip_height, consensus_hash FROM snapshots WHERE block_height = ?;",
 			block_height)
 		if err := row.Scan(&winningBlockTxid, &stacks_height, &consensus_hash); err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("snapshot at burn height %d: %w", block_height, err)
 		}
 
 		if _, exists := blockCommitsMap[block_height]; !exists {
@@ -342,6 +495,7 @@ func processWinningBlocks(db *sqlx.DB, cdb *sqlx.DB, lower_bound_height, start_b
 			}
 		}
 	}
+	return nil
 }
 
 func processWinningCommit(cdb *sqlx.DB, commit *BlockCommit, parent_commit *BlockCommit, parentExists bool, stacks_height int, consensus_hash string) {
@@ -365,10 +519,10 @@ func processWinningCommit(cdb *sqlx.DB, commit *BlockCommit, parent_commit *Bloc
 	}
 }
 
-func processCanonicalTip(db *sqlx.DB, start_block int, commits map[string]*BlockCommit) {
+func processCanonicalTip(db *sqlx.DB, start_block int, commits map[string]*BlockCommit) error {
 	var canonical_tip string
 	if err := db.Get(&canonical_tip, "SELECT winning_block_txid FROM snapshots WHERE block_height = ?;", start_block); err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("snapshot at burn height %d: %w", start_block, err)
 	}
 	tip := canonical_tip
 	for {
@@ -382,6 +536,7 @@ func processCanonicalTip(db *sqlx.DB, start_block int, commits map[string]*Block
 		commit.canonical = true
 		tip = commit.parent
 	}
+	return nil
 }
 
 func generateGraph(lower_bound_height, start_block int, blockCommits BlockCommits) string {
@@ -473,11 +628,17 @@ func stringToColor(input string) string {
 	return pastelColors[index]
 }
 
+// parentMissed reports whether a commit's parent is not in last_height, the
+// previous burn block with commits, i.e. the miner skipped over a block.
+func parentMissed(parentCommit *BlockCommit, last_height int) bool {
+	return last_height > 0 && parentCommit.burnBlockHeight != last_height
+}
+
 func makeEdgeAttributes(commit *BlockCommit, parentCommit *BlockCommit, last_height int) AttributeMap {
 	attrs := make(AttributeMap)
 	attrs["color"] = "black"
 	attrs["penwidth"] = "1"
-	if last_height > 0 && parentCommit.burnBlockHeight != last_height {
+	if parentMissed(parentCommit, last_height) {
 		attrs["color"] = "red"
 		attrs["penwidth"] = "4"
 	}
@@ -507,31 +668,78 @@ func errFunc(name string) func(e error) {
 	}
 }
 
+// Burn blocks below the tip dotsTask graphs
+const dotsWindowBlocks = 20
+
 func dotsTask() error {
 	db, cdb := openDatabases()
 	defer db.Close()
 	defer cdb.Close()
 
-	startBlock, lowerBound := getBlockRange(db, 20)
-	blockCommits := fetchCommitData(db, lowerBound, startBlock)
-	processWinningBlocks(db, cdb, lowerBound, startBlock, blockCommits)
-	processCanonicalTip(db, startBlock, blockCommits.AllCommits)
+	startBlock, lowerBound := getBlockRange(db, dotsWindowBlocks)
+	blockCommits, err := collectBlockCommits(db, cdb, lowerBound, startBlock)
+	if err != nil {
+		return err
+	}
 	dot := generateGraph(lowerBound, startBlock, blockCommits)
+	graph, err := json.Marshal(buildGraph(lowerBound, startBlock, blockCommits))
+	if err != nil {
+		return err
+	}
 
 	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite"))
 	defer hubDb.Close()
 
-	_, err := hubDb.Exec("INSERT INTO dots (bitcoin_block_height, dot) VALUES (?, ?)",
-		startBlock, dot)
+	if _, err := hubDb.Exec("INSERT INTO dots (bitcoin_block_height, dot) VALUES (?, ?)",
+		startBlock, dot); err != nil {
+		return err
+	}
+	if _, err := hubDb.Exec("INSERT INTO graphs (bitcoin_block_height, data) VALUES (?, ?)",
+		startBlock, graph); err != nil {
+		return err
+	}
+
+	_, err = recordForkEvents(hubDb, detectForkEvents(lowerBound, startBlock, blockCommits))
 	return err
 }
 
-type mempoolTxn struct {
-	Txid   string `db:"txid"`
-	TxFee  int    `db:"tx_fee"`
-	Length int    `db:"length"`
-	Age    int    `db:"age"`
-	TxBlob string `db:"tx"`
+// minerPowerTask records the miner power over the last day for the current
+// Bitcoin block, once per block.
+func minerPowerTask() error {
+	db, cdb := openDatabases()
+	defer db.Close()
+	defer cdb.Close()
+
+	startBlock, lowerBound := getBlockRange(db, defaultMinerPowerBlocks)
+
+	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite"))
+	defer hubDb.Close()
+
+	var recorded bool
+	if err := hubDb.Get(&recorded,
+		"SELECT EXISTS (SELECT 1 FROM miner_power WHERE bitcoin_block_height = ?)", startBlock); err != nil {
+		return err
+	}
+	if recorded {
+		return nil
+	}
+
+	miners := queryMinerPower(db, cdb, lowerBound, startBlock)
+
+	tx, err := hubDb.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, m := range miners {
+		if _, err := tx.Exec(`INSERT INTO miner_power
+			(bitcoin_block_height, stacks_recipient, bitcoin_address, blocks_won, btc_spent, stx_earnt, win_rate)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			startBlock, m.StacksRecipient, m.BitcoinAddress, m.BlocksWon, m.BtcSpent, m.StxEarnt, m.WinRate); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 type ContractCount struct {
@@ -540,32 +748,40 @@ type ContractCount struct {
 }
 
 type MempoolData struct {
-	Popular          []ContractCount
-	FeeDistribution  []hdrhistogram.Bracket
-	SizeDistribution []hdrhistogram.Bracket
-	AgeDistribution  []hdrhistogram.Bracket
+	Popular         []ContractCount
+	FeeDistribution []hdrhistogram.Bracket
+	// Fee per byte, in uSTX
+	FeeRateDistribution []hdrhistogram.Bracket
+	SizeDistribution    []hdrhistogram.Bracket
+	AgeDistribution     []hdrhistogram.Bracket
+	// Buckets per contract function, by payload category
+	Breakdown map[string][]MempoolBucket
+	// Fee rate quantiles, in uSTX per byte
+	FeeRates FeeRates
 }
 
 func mempoolTask() error {
 	// ideas for a potential mempool endpoint
 	// - number of "old" transactions
-	mdb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, mempoolDb))
-	defer mdb.Close()
-
-	mempool := []mempoolTxn{}
-	if err := mdb.Select(&mempool,
-		"SELECT txid, tx_fee, length, (unixepoch() - accept_time) as age, LOWER(HEX(tx)) AS tx FROM mempool"); err != nil {
+	readAt := time.Now().Unix()
+	mempool, err := readMempool()
+	if err != nil {
 		log.Fatal(err)
 	}
-	// Proactively close mdb
-	mdb.Close()
 
 	fees := []float32{}
+	feeRates := []float64{}
 	lengths := []int{}
 	txnCounts := make(map[string]int)
+	breakdown := make(mempoolBreakdown)
+	// Decoded transactions for the mempool snapshot
+	txs := []MempoolTx{}
+	decoded := make(map[string]Tx)
 
 	// Technically fee is uncapped, but 1000 STX is a good upper bound
 	feeHist := hdrhistogram.New(1, 1_000_000_000, 1)
+	// Same bound on the fee, spread over the smallest possible transaction
+	feeRateHist := hdrhistogram.New(1, 10_000_000, 1)
 	// Size can't be more than 2MB. Limit to 10MB to be safe
 	sizeHist := hdrhistogram.New(1, 10*1024*1024, 1)
 	// Age can't greater than 256 Bitcoin blocks. Limit to 500 to be safe
@@ -573,24 +789,23 @@ func mempoolTask() error {
 
 	for _, txn := range mempool {
 		feeHist.RecordValue(int64(txn.TxFee))
+		feeRateHist.RecordValue(int64(math.Round(txn.FeeRate())))
 		sizeHist.RecordValue(int64(txn.Length))
 		ageHist.RecordValue(int64(txn.Age))
 
 		// ageHist.RecordValue(txn.)
 		fees = append(fees, float32(txn.TxFee)/1_000_000)
+		feeRates = append(feeRates, txn.FeeRate())
 		lengths = append(lengths, txn.Length)
 
-		var tx codec.Transaction
-		data, err := hex.DecodeString(txn.TxBlob)
-		if err != nil {
-			log.Printf("Failed to hex decode txid %s, blob %s\n", txn.Txid, txn.TxBlob)
-			continue
-		}
-		err = tx.Decode(bytes.NewReader(data))
+		tx, err := decodeTx(txn.TxBlob)
 		if err != nil {
 			log.Printf("Failed to txn decode txid %s, blob %s\n", txn.Txid, txn.TxBlob)
 			continue
 		}
+		txs = append(txs, newMempoolTx(txn, &tx))
+		decoded[txn.Txid] = tx
+		breakdown.add(txn, &tx.Transaction)
 		if tx.Payload.Transfer != nil {
 			txnCounts["simple-token-transfer"] += 1
 		} else if tx.Payload.ContractCall != nil {
@@ -600,6 +815,8 @@ func mempoolTask() error {
 		}
 	}
 
+	setMempoolSnapshot(readAt, txs, decoded)
+
 	counters := []ContractCount{}
 	for k, v := range txnCounts {
 		counters = append(counters, ContractCount{k, v})
@@ -613,18 +830,37 @@ func mempoolTask() error {
 	defer hubDb.Close()
 
 	var d MempoolData
-	d.Popular = counters[:25]
+	d.Popular = counters[:min(25, len(counters))]
 	d.FeeDistribution = feeHist.CumulativeDistribution()
+	d.FeeRateDistribution = feeRateHist.CumulativeDistribution()
 	d.SizeDistribution = sizeHist.CumulativeDistribution()
 	d.AgeDistribution = ageHist.CumulativeDistribution()
+	d.Breakdown = breakdown.buckets()
+	d.FeeRates = feeRateQuantiles(slices.Clone(feeRates))
 
 	// TODO: handle errors
 	blob, _ := json.Marshal(d)
-	_, err := hubDb.Exec("INSERT INTO mempool_stats (count, data) VALUES (?, ?)",
+	_, err = hubDb.Exec("INSERT INTO mempool_stats (count, data) VALUES (?, ?)",
 		len(mempool), blob)
 	if err != nil {
 		log.Printf("Error inserting mempool stats: %v\n", err)
+		return err
 	}
+
+	if err := trackMempoolChurn(hubDb, mempool, readAt); err != nil {
+		log.Printf("Error tracking mempool churn: %v\n", err)
+	}
+
+	minedRates, err := minedFeeRates(feeEstimateBurnBlocks)
+	if err != nil {
+		log.Printf("Error fetching mined fee rates: %v\n", err)
+		return err
+	}
+	blob, err = json.Marshal(estimateFees(feeRates, minedRates))
+	if err != nil {
+		return err
+	}
+	_, err = hubDb.Exec("INSERT INTO fee_estimates (data) VALUES (?)", blob)
 	return err
 }
 
@@ -666,11 +902,22 @@ func pruneTask() error {
 	hubDb := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, "hub.sqlite"))
 	defer hubDb.Close()
 
+	// Summarize the mempool snapshots before they're gone
+	if err := rollupMempoolStats(hubDb); err != nil {
+		return err
+	}
+
 	tx := hubDb.MustBegin()
 	defer tx.Rollback()
 
-	tx.MustExec("DELETE FROM mempool_stats WHERE timestamp < datetime('now', '-2 days')")
+	tx.MustExec("DELETE FROM mempool_stats WHERE timestamp < datetime('now', ?)",
+		fmt.Sprintf("-%d hours", int(resolutionRetention[ResolutionRaw].Hours())))
+	tx.MustExec("DELETE FROM fee_estimates WHERE timestamp < datetime('now', '-2 days')")
+	tx.MustExec("DELETE FROM mempool_txs WHERE exit < unixepoch('now', '-2 days')")
+	tx.MustExec("DELETE FROM mempool_rollups WHERE resolution = ? AND timestamp < datetime('now', ?)",
+		ResolutionHour, fmt.Sprintf("-%d hours", int(resolutionRetention[ResolutionHour].Hours())))
 	tx.MustExec("DELETE FROM dots WHERE timestamp < datetime('now', '-2 days')")
+	tx.MustExec("DELETE FROM graphs WHERE timestamp < datetime('now', '-2 days')")
 	tx.Commit()
 
 	// Can't vacuum from within a transactions, sqlite panics.
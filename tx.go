@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/stxpub/codec"
+)
+
+// decodeTx decodes a hex encoded transaction
+func decodeTx(txHex string) (Tx, error) {
+	data, err := hex.DecodeString(txHex)
+	if err != nil {
+		return Tx{}, err
+	}
+	return decodeRawTx(data)
+}
+
+// Tx is a transaction as decoded by the codec, along with the hex encoded
+// bytes the codec doesn't parse, such as contract call arguments and transfer
+// memos, so that it can be encoded back. FunctionArgs are the decoded
+// arguments of contract calls, or FunctionArgsError is set if they fail to
+// decode. NFTAssetNames are the hex encoded asset names of the NFT post
+// conditions, in order, as their Clarity type can't always be told from the
+// codec's JSON.
+type Tx struct {
+	codec.Transaction
+	Unparsed          string
+	FunctionArgs      []ClarityValue
+	FunctionArgsError string
+	NFTAssetNames     []string
+}
+
+// decodeRawTx decodes a serialized transaction. Bytes after the end of the
+// transaction aren't part of it.
+func decodeRawTx(raw []byte) (Tx, error) {
+	var tx Tx
+	r := bytes.NewReader(raw)
+	if err := tx.Decode(r); err != nil {
+		return tx, err
+	}
+	read := len(raw) - r.Len()
+	if n, err := txLength(raw); err == nil && n >= read {
+		tx.Unparsed = hex.EncodeToString(raw[read:n])
+	}
+	if tx.Payload.ContractCall != nil {
+		// The codec doesn't read the arguments, they may not decode
+		args, err := contractCallArgs(raw)
+		if err != nil {
+			tx.FunctionArgsError = err.Error()
+		} else {
+			tx.FunctionArgs = args
+		}
+	}
+	var err error
+	if tx.NFTAssetNames, err = nftAssetNames(raw); err != nil {
+		return tx, err
+	}
+	return tx, nil
+}
+
+// nftAssetNames returns the serialized asset names of the NFT post conditions
+// of raw, hex encoded. They are the bytes the codec reads them from, so that
+// encoding them back gives the same transaction.
+func nftAssetNames(raw []byte) ([]string, error) {
+	var tx codec.Transaction
+	r := bytes.NewReader(raw)
+	if err := tx.Version.Decode(r); err != nil {
+		return nil, err
+	}
+	if err := tx.CID.Decode(r); err != nil {
+		return nil, err
+	}
+	if err := tx.Authorization.Decode(r); err != nil {
+		return nil, err
+	}
+	if err := tx.AnchorMode.Decode(r); err != nil {
+		return nil, err
+	}
+	if err := tx.PostConditionMode.Decode(r); err != nil {
+		return nil, err
+	}
+	var pcCount uint32
+	if err := binary.Read(r, binary.BigEndian, &pcCount); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for i := uint32(0); i < pcCount; i++ {
+		start := len(raw) - r.Len()
+		var pc codec.PostCondition
+		if err := pc.Decode(r); err != nil {
+			return nil, err
+		}
+		if pc.NFT == nil {
+			continue
+		}
+		// The asset name is between the asset info and the condition code
+		end := len(raw) - r.Len()
+		body := bytes.NewReader(raw[start+1 : end])
+		var nft codec.NFTPostConditionBody
+		if err := nft.Principal.Decode(body); err != nil {
+			return nil, err
+		}
+		if err := nft.AssetInfo.Decode(body); err != nil {
+			return nil, err
+		}
+		names = append(names, hex.EncodeToString(raw[end-body.Len():end-1]))
+	}
+	return names, nil
+}
+
+const (
+	// Largest number of transactions decoded by one /tx/decode/batch request
+	maxDecodeBatch = 10_000
+
+	// Decoded transactions are returned as decoded by default
+	ViewSummary = "summary"
+)
+
+// DecodedTx is the result of decoding one transaction of a batch. Error is
+// set instead of Transaction if it failed to decode. Transaction is a Tx, or
+// a TxSummary for the summary view. Verification is only set when requested.
+type DecodedTx struct {
+	Index        int
+	Transaction  any
+	Verification *TxVerification
+	Error        string
+}
+
+// VerifiedTx is a decoded transaction along with its signature verification
+type VerifiedTx struct {
+	Transaction  any
+	Verification *TxVerification
+}
+
+// validView checks the view query parameter of the decode endpoints
+func validView(view string) error {
+	if view != "" && view != ViewSummary {
+		return fmt.Errorf("view must be %s or absent, got %q", ViewSummary, view)
+	}
+	return nil
+}
+
+// parseTxBatch splits a batch of hex encoded transactions, either a JSON
+// array of strings or one transaction per line. Blank lines are skipped.
+func parseTxBatch(body []byte) ([]string, error) {
+	body = bytes.TrimSpace(body)
+	var txs []string
+	if bytes.HasPrefix(body, []byte("[")) {
+		if err := json.Unmarshal(body, &txs); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %w", err)
+		}
+	} else {
+		for _, line := range strings.Split(string(body), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				txs = append(txs, line)
+			}
+		}
+	}
+	if len(txs) > maxDecodeBatch {
+		return nil, fmt.Errorf("at most %d transactions can be decoded at once, got %d", maxDecodeBatch, len(txs))
+	}
+	return txs, nil
+}
+
+// decodeTxBatch decodes every transaction of a batch independently
+func decodeTxBatch(txs []string, view string, verify bool) []DecodedTx {
+	results := make([]DecodedTx, len(txs))
+	for i, txHex := range txs {
+		results[i].Index = i
+		data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(txHex), "0x"))
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		tx, err := decodeRawTx(data)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if view == ViewSummary {
+			results[i].Transaction = summarizeTx(data, &tx)
+		} else {
+			results[i].Transaction = tx
+		}
+		if verify {
+			results[i].Verification = verifyTx(data, &tx.Transaction)
+		}
+	}
+	return results
+}
+
+// spendingConditionAddress derives the Stacks address of the account that
+// signs with the spending condition sc. As in stacks-core, only P2PKH
+// accounts have a single-sig address version, P2WPKH ones are hashed from a
+// P2SH script and use the multi-sig version.
+func spendingConditionAddress(version codec.NetworkVersion, sc *codec.SpendingCondition) string {
+	addr := codec.Address{HashBytes: sc.PubKeyHash}
+	singleSig := sc.HashMode == codec.P2PKH
+	switch {
+	case version == codec.Mainnet && singleSig:
+		addr.Version = codec.MainnetSingleSig
+	case version == codec.Mainnet:
+		addr.Version = codec.MainnetMultiSig
+	case singleSig:
+		addr.Version = codec.TestnetSingleSig
+	default:
+		addr.Version = codec.TestnetMultiSig
+	}
+	return addr.ToStacks()
+}
+
+// txSender returns the address of the account that originated tx
+func txSender(tx *codec.Transaction) string {
+	return spendingConditionAddress(tx.Version, &tx.Authorization.OriginCondition)
+}
+
+// txSponsor returns the address of the account that sponsored tx, if any
+func txSponsor(tx *codec.Transaction) string {
+	if tx.Authorization.SponsorCondition == nil {
+		return ""
+	}
+	return spendingConditionAddress(tx.Version, tx.Authorization.SponsorCondition)
+}
+
+// txContract returns the fully qualified name of the contract tx calls or
+// deploys, or an empty string for other payloads.
+func txContract(tx *codec.Transaction) string {
+	switch {
+	case tx.Payload.ContractCall != nil:
+		return tx.Payload.ContractCall.Origin.ToStacks() + "." + string(tx.Payload.ContractCall.Contract)
+	case tx.Payload.ContractDeploy != nil:
+		return txSender(tx) + "." + string(tx.Payload.ContractDeploy.ContractName)
+	case tx.Payload.VersionedContractDeploy != nil:
+		return txSender(tx) + "." + string(tx.Payload.VersionedContractDeploy.ContractName)
+	}
+	return ""
+}
+
+// txFunction returns the name of the function tx calls, if it is a contract call
+func txFunction(tx *codec.Transaction) string {
+	if tx.Payload.ContractCall == nil {
+		return ""
+	}
+	return string(tx.Payload.ContractCall.Function)
+}
+
+// TxSummary is a human readable view of a transaction
+type TxSummary struct {
+	Txid    string
+	Network string
+	Sender  string
+	Sponsor string
+	Nonce   uint64
+	// Fee paid by the sponsor if sponsored, in uSTX and STX
+	Fee               uint64
+	FeeSTX            float64
+	PayloadType       string
+	Payload           string
+	PostConditionMode string
+	PostConditions    []string
+}
+
+// formatSTX formats an amount in uSTX as STX
+func formatSTX(amount uint64) string {
+	s := fmt.Sprintf("%d.%06d", amount/1_000_000, amount%1_000_000)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s + " STX"
+}
+
+// principalString renders a post condition or transfer recipient principal
+func principalString(p *codec.Principal) string {
+	switch p.Type {
+	case 0x01:
+		return "origin"
+	case codec.PrincipalContract, codec.RecipientContract:
+		return p.Address.ToStacks() + "." + string(p.ContractName)
+	}
+	return p.Address.ToStacks()
+}
+
+func assetString(a *codec.AssetInfo) string {
+	return fmt.Sprintf("%s.%s::%s", a.Address.ToStacks(), a.ContractName, a.AssetName)
+}
+
+var fungibleConditions = map[codec.FungibleConditionCode]string{
+	codec.SentEq: "exactly",
+	codec.SentGt: "more than",
+	codec.SentGe: "at least",
+	codec.SentLt: "less than",
+	codec.SentLe: "at most",
+}
+
+func postConditionString(pc *codec.PostCondition) string {
+	switch {
+	case pc.STX != nil:
+		return fmt.Sprintf("%s sends %s %s", principalString(&pc.STX.Principal),
+			fungibleConditions[pc.STX.Code], formatSTX(pc.STX.Amount))
+	case pc.FT != nil:
+		return fmt.Sprintf("%s sends %s %d %s", principalString(&pc.FT.Principal),
+			fungibleConditions[pc.FT.Code], pc.FT.Amount, assetString(&pc.FT.AssetInfo))
+	case pc.NFT != nil && pc.NFT.Code == codec.NotSent:
+		return fmt.Sprintf("%s does not send %s", principalString(&pc.NFT.Principal), assetString(&pc.NFT.AssetInfo))
+	case pc.NFT != nil:
+		return fmt.Sprintf("%s sends %s", principalString(&pc.NFT.Principal), assetString(&pc.NFT.AssetInfo))
+	}
+	return pc.Type.String()
+}
+
+func payloadString(tx *Tx) string {
+	p := &tx.Payload
+	switch {
+	case p.Transfer != nil:
+		return fmt.Sprintf("transfer %s to %s", formatSTX(p.Transfer.Amount), principalString(&p.Transfer.Recipient))
+	case p.ContractCall != nil:
+		return fmt.Sprintf("call %s::%s(%s)", txContract(&tx.Transaction), txFunction(&tx.Transaction),
+			strings.Join(clarityReprs(tx.FunctionArgs), ", "))
+	case p.ContractDeploy != nil:
+		return fmt.Sprintf("deploy %s", txContract(&tx.Transaction))
+	case p.VersionedContractDeploy != nil:
+		return fmt.Sprintf("deploy %s (Clarity %d)", txContract(&tx.Transaction), p.VersionedContractDeploy.ClarityVersion)
+	case p.Coinbase != nil, p.NakamotoCoinbase != nil:
+		return "coinbase"
+	case p.TenureChange != nil:
+		return "tenure change"
+	}
+	return p.Type.String()
+}
+
+// summarizeTx summarizes tx, decoded from raw
+func summarizeTx(raw []byte, tx *Tx) TxSummary {
+	// raw may have trailing bytes, the txid only covers the transaction
+	if n, err := txLength(raw); err == nil {
+		raw = raw[:n]
+	}
+	fee := tx.Authorization.OriginCondition.Fee
+	if tx.Authorization.SponsorCondition != nil {
+		fee = tx.Authorization.SponsorCondition.Fee
+	}
+	s := TxSummary{
+		Txid:              txid(raw),
+		Network:           tx.Version.String(),
+		Sender:            txSender(&tx.Transaction),
+		Sponsor:           txSponsor(&tx.Transaction),
+		Nonce:             tx.Authorization.OriginCondition.Nonce,
+		Fee:               fee,
+		FeeSTX:            float64(fee) / 1_000_000,
+		PayloadType:       tx.Payload.Type.String(),
+		Payload:           payloadString(tx),
+		PostConditionMode: tx.PostConditionMode.String(),
+		PostConditions:    []string{},
+	}
+	for _, pc := range tx.PostConditions {
+		s.PostConditions = append(s.PostConditions, postConditionString(pc))
+	}
+	return s
+}
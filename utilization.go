@@ -0,0 +1,261 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Nakamoto blocks share the execution budget of their tenure, which is reset
+// by tenure extensions. Consensus puts no limit on a single block, which may
+// use all of the remaining budget.
+var tenureCostLimit = CostVector{
+	ReadLength:  100_000_000,
+	ReadCount:   15_000,
+	WriteLength: 15_000_000,
+	WriteCount:  15_000,
+	Runtime:     5_000_000_000,
+}
+
+const (
+	// Largest serialized block, in bytes
+	maxBlockSize = 2 * 1024 * 1024
+
+	// Percentage of the remaining tenure budget a miner spends on one block.
+	// This is the stacks-core default of tenure_cost_limit_per_block_percentage,
+	// a miner setting rather than a consensus limit.
+	blockBudgetPercentage = 25
+
+	// A tenure's budget is considered exhausted past this percentage of one
+	// of its dimensions, as few transactions still fit
+	fullUtilization = 95
+
+	// Default window for /blocks/utilization, one day of Bitcoin blocks
+	defaultUtilizationBlocks = 144
+	// Largest window /blocks/utilization will return, roughly a month
+	maxUtilizationBlocks = 144 * 30
+)
+
+// CostUtilization is a cost vector as percentages of a budget. Binding is
+// the dimension closest to its limit, empty when nothing was spent.
+type CostUtilization struct {
+	ReadLength  float64 `json:"read_length"`
+	ReadCount   float64 `json:"read_count"`
+	WriteLength float64 `json:"write_length"`
+	WriteCount  float64 `json:"write_count"`
+	Runtime     float64 `json:"runtime"`
+	Binding     string  `json:"binding"`
+}
+
+// BlockUtilization is how much of the limits a block uses. Block is the
+// block's own cost against the default miner budget for a block, and Tenure
+// the tenure's total after it against the tenure budget. Size is the block's
+// size as a percentage of the largest block. Full is set once the tenure's
+// budget is exhausted.
+type BlockUtilization struct {
+	Block  CostUtilization
+	Tenure CostUtilization
+	Size   float64
+	Full   bool
+}
+
+// percentOf returns v as a percentage of limit. Anything spent against an
+// exhausted limit is 100%.
+func percentOf(v, limit int) float64 {
+	if limit <= 0 {
+		if v > 0 {
+			return 100
+		}
+		return 0
+	}
+	return float64(v) / float64(limit) * 100
+}
+
+// costUtilization computes cv as percentages of limit
+func costUtilization(cv, limit CostVector) CostUtilization {
+	u := CostUtilization{
+		ReadLength:  percentOf(cv.ReadLength, limit.ReadLength),
+		ReadCount:   percentOf(cv.ReadCount, limit.ReadCount),
+		WriteLength: percentOf(cv.WriteLength, limit.WriteLength),
+		WriteCount:  percentOf(cv.WriteCount, limit.WriteCount),
+		Runtime:     percentOf(cv.Runtime, limit.Runtime),
+	}
+	u.Binding, _ = u.max()
+	return u
+}
+
+// blockBudget returns the default miner budget for a block: a percentage of
+// what the tenure had left before it
+func blockBudget(b *Block) CostVector {
+	budget := func(limit, tenure, block int) int {
+		return max(limit-(tenure-block), 0) * blockBudgetPercentage / 100
+	}
+	return CostVector{
+		ReadLength:  budget(tenureCostLimit.ReadLength, b.TenureCost.ReadLength, b.Cost.ReadLength),
+		ReadCount:   budget(tenureCostLimit.ReadCount, b.TenureCost.ReadCount, b.Cost.ReadCount),
+		WriteLength: budget(tenureCostLimit.WriteLength, b.TenureCost.WriteLength, b.Cost.WriteLength),
+		WriteCount:  budget(tenureCostLimit.WriteCount, b.TenureCost.WriteCount, b.Cost.WriteCount),
+		Runtime:     budget(tenureCostLimit.Runtime, b.TenureCost.Runtime, b.Cost.Runtime),
+	}
+}
+
+// max returns the dimension closest to its limit and its percentage, or no
+// dimension if all are zero
+func (u CostUtilization) max() (string, float64) {
+	binding, highest := "", 0.0
+	for _, d := range []struct {
+		name  string
+		value float64
+	}{
+		{"read_length", u.ReadLength},
+		{"read_count", u.ReadCount},
+		{"write_length", u.WriteLength},
+		{"write_count", u.WriteCount},
+		{"runtime", u.Runtime},
+	} {
+		if d.value > highest {
+			binding, highest = d.name, d.value
+		}
+	}
+	return binding, highest
+}
+
+func blockUtilization(b *Block) BlockUtilization {
+	u := BlockUtilization{
+		Block:  costUtilization(b.Cost, blockBudget(b)),
+		Tenure: costUtilization(b.TenureCost, tenureCostLimit),
+		Size:   percentOf(b.BlockSize, maxBlockSize),
+	}
+	_, tenureMax := u.Tenure.max()
+	u.Full = tenureMax >= fullUtilization
+	return u
+}
+
+// UtilizationPoint aggregates the utilization of the blocks of one burn
+// block. Block averages the blocks' own utilization and Tenure is the
+// highest tenure utilization reached. Binding counts, per dimension, the
+// blocks whose tenure utilization it was binding for, leaving out blocks
+// whose tenure had spent nothing.
+type UtilizationPoint struct {
+	BurnHeaderHeight int
+	Blocks           int
+	FullBlocks       int
+	Block            CostUtilization
+	Tenure           CostUtilization
+	AvgSize          float64
+	Binding          map[string]int
+}
+
+// UtilizationSeries is the utilization of the canonical blocks of the burn
+// blocks in (From, To], one point per burn block with Stacks blocks, in
+// height order.
+type UtilizationSeries struct {
+	From       int
+	To         int
+	Blocks     int
+	FullBlocks int
+	Binding    map[string]int
+	Points     []UtilizationPoint
+}
+
+// blocksTip returns the highest burn height with a Nakamoto block
+func blocksTip() (int, error) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, chainstateDb))
+	defer db.Close()
+
+	var tip int
+	err := db.Get(&tip, "SELECT COALESCE(MAX(burn_header_height), 0) FROM nakamoto_block_headers")
+	return tip, err
+}
+
+// getUtilizationSeries aggregates the utilization of the canonical blocks
+// anchored to the burn blocks in (lowerBound, upperBound]. Sibling blocks
+// that lost to another block at their height are left out.
+func getUtilizationSeries(lowerBound, upperBound int) (UtilizationSeries, error) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(config.DataDir, chainstateDb))
+	defer db.Close()
+
+	s := UtilizationSeries{From: lowerBound, To: upperBound, Binding: map[string]int{}, Points: []UtilizationPoint{}}
+	const query = `
+	SELECT
+		block_size,
+		cost,
+		total_tenure_cost,
+		tenure_changed,
+		tenure_tx_fees,
+		block_height,
+		burn_header_height,
+		timestamp,
+		index_block_hash
+	FROM nakamoto_block_headers
+	WHERE burn_header_height > ? AND burn_header_height <= ?
+	ORDER BY block_height ASC
+	`
+	var headers []struct {
+		Block
+		IndexBlockHash string `db:"index_block_hash"`
+	}
+	if err := db.Select(&headers, query, lowerBound, upperBound); err != nil {
+		return s, err
+	}
+	if len(headers) == 0 {
+		return s, nil
+	}
+	canonical, err := canonicalBlocks(db, headers[0].BlockHeight)
+	if err != nil {
+		return s, err
+	}
+
+	var p *UtilizationPoint
+	var sizes float64
+	closePoint := func() {
+		if p == nil {
+			return
+		}
+		n := float64(p.Blocks)
+		p.Block.ReadLength /= n
+		p.Block.ReadCount /= n
+		p.Block.WriteLength /= n
+		p.Block.WriteCount /= n
+		p.Block.Runtime /= n
+		p.Block.Binding, _ = p.Block.max()
+		p.Tenure.Binding, _ = p.Tenure.max()
+		p.AvgSize = sizes / n
+		s.Points = append(s.Points, *p)
+	}
+	for i := range headers {
+		if _, ok := canonical[headers[i].IndexBlockHash]; !ok {
+			continue
+		}
+		b := &headers[i].Block
+		if p == nil || p.BurnHeaderHeight != b.BurnHeaderHeight {
+			closePoint()
+			p = &UtilizationPoint{BurnHeaderHeight: b.BurnHeaderHeight, Binding: map[string]int{}}
+			sizes = 0
+		}
+		u := blockUtilization(b)
+		p.Blocks += 1
+		sizes += u.Size
+		p.Block.ReadLength += u.Block.ReadLength
+		p.Block.ReadCount += u.Block.ReadCount
+		p.Block.WriteLength += u.Block.WriteLength
+		p.Block.WriteCount += u.Block.WriteCount
+		p.Block.Runtime += u.Block.Runtime
+		p.Tenure.ReadLength = max(p.Tenure.ReadLength, u.Tenure.ReadLength)
+		p.Tenure.ReadCount = max(p.Tenure.ReadCount, u.Tenure.ReadCount)
+		p.Tenure.WriteLength = max(p.Tenure.WriteLength, u.Tenure.WriteLength)
+		p.Tenure.WriteCount = max(p.Tenure.WriteCount, u.Tenure.WriteCount)
+		p.Tenure.Runtime = max(p.Tenure.Runtime, u.Tenure.Runtime)
+		if u.Tenure.Binding != "" {
+			p.Binding[u.Tenure.Binding] += 1
+			s.Binding[u.Tenure.Binding] += 1
+		}
+		s.Blocks += 1
+		if u.Full {
+			p.FullBlocks += 1
+			s.FullBlocks += 1
+		}
+	}
+	closePoint()
+	return s, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBlockUtilization(t *testing.T) {
+	tests := []struct {
+		name          string
+		block         Block
+		blockRuntime  float64
+		tenureRuntime float64
+		blockBinding  string
+		tenureBinding string
+		full          bool
+	}{
+		{
+			name: "empty block",
+		},
+		{
+			name: "first block of a tenure",
+			block: Block{
+				Cost:       CostVector{Runtime: 625_000_000},
+				TenureCost: CostVector{Runtime: 625_000_000},
+			},
+			blockRuntime:  50,
+			tenureRuntime: 12.5,
+			blockBinding:  "runtime",
+			tenureBinding: "runtime",
+		},
+		{
+			name: "block after half the tenure budget",
+			block: Block{
+				Cost:       CostVector{Runtime: 625_000_000, ReadCount: 15},
+				TenureCost: CostVector{Runtime: 3_125_000_000, ReadCount: 15},
+			},
+			blockRuntime:  100,
+			tenureRuntime: 62.5,
+			blockBinding:  "runtime",
+			tenureBinding: "runtime",
+		},
+		{
+			name: "block after an exhausted tenure",
+			block: Block{
+				Cost:       CostVector{Runtime: 1},
+				TenureCost: CostVector{Runtime: 5_000_000_001},
+			},
+			blockRuntime:  100,
+			tenureRuntime: 100.00000002,
+			blockBinding:  "runtime",
+			tenureBinding: "runtime",
+			full:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := blockUtilization(&tt.block)
+			if math.Abs(u.Block.Runtime-tt.blockRuntime) > 1e-6 {
+				t.Errorf("block runtime = %v, want %v", u.Block.Runtime, tt.blockRuntime)
+			}
+			if math.Abs(u.Tenure.Runtime-tt.tenureRuntime) > 1e-6 {
+				t.Errorf("tenure runtime = %v, want %v", u.Tenure.Runtime, tt.tenureRuntime)
+			}
+			if u.Block.Binding != tt.blockBinding {
+				t.Errorf("block binding = %q, want %q", u.Block.Binding, tt.blockBinding)
+			}
+			if u.Tenure.Binding != tt.tenureBinding {
+				t.Errorf("tenure binding = %q, want %q", u.Tenure.Binding, tt.tenureBinding)
+			}
+			if u.Full != tt.full {
+				t.Errorf("full = %v, want %v", u.Full, tt.full)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/stxpub/codec"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Signatures are verified following SIP-005: each signer signs the sighash of
+// the transaction with its spending conditions cleared, chained with the
+// signatures before it. The origin signs first, as a standard authorization,
+// then the sponsor signs on top of the origin's final sighash.
+
+const (
+	authStandard  = 0x04
+	authSponsored = 0x05
+)
+
+// SignerVerification is the outcome of checking one signature of a spending
+// condition, or a public key listed by a multisig condition.
+type SignerVerification struct {
+	PublicKey string
+	// Single-sig address of the public key
+	Address string
+	// Whether this is a signature, as opposed to a listed public key
+	Signed bool
+	Error  string
+}
+
+type ConditionVerification struct {
+	// Address the spending condition claims
+	Signer string
+	// Address derived from the recovered public keys
+	DerivedSigner      string
+	SignaturesRequired int
+	Signatures         int
+	Signers            []SignerVerification
+	Valid              bool
+	Error              string
+}
+
+type TxVerification struct {
+	// Sighash of the transaction with its authorization cleared
+	InitialSighash string
+	Origin         ConditionVerification
+	Sponsor        *ConditionVerification
+	Valid          bool
+	Error          string
+}
+
+func hash160(b []byte) []byte {
+	sha := sha256.Sum256(b)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
+
+func sha512_256(parts ...[]byte) []byte {
+	h := sha512.New512_256()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// presignSighash is what a signer of the condition signs, given the sighash
+// so far
+func presignSighash(sighash []byte, authFlag byte, fee, nonce uint64) []byte {
+	var buf [17]byte
+	buf[0] = authFlag
+	binary.BigEndian.PutUint64(buf[1:9], fee)
+	binary.BigEndian.PutUint64(buf[9:], nonce)
+	return sha512_256(sighash, buf[:])
+}
+
+// postsignSighash is the sighash the next signer builds on
+func postsignSighash(presign []byte, keyEncoding byte, signature []byte) []byte {
+	return sha512_256(presign, []byte{keyEncoding}, signature)
+}
+
+// recoverPublicKey recovers the serialized public key that made signature
+// over hash. Stacks signatures start with the recovery id, then R and S.
+func recoverPublicKey(hash, signature []byte, compressed bool) ([]byte, error) {
+	if len(signature) != 65 || signature[0] > 3 {
+		return nil, errors.New("invalid recoverable signature")
+	}
+	compact := make([]byte, 65)
+	compact[0] = 27 + signature[0]
+	if compressed {
+		compact[0] += 4
+	}
+	copy(compact[1:], signature[1:])
+	key, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		return key.SerializeCompressed(), nil
+	}
+	return key.SerializeUncompressed(), nil
+}
+
+// multisigScript is the Bitcoin style m-of-n CHECKMULTISIG redeem script
+func multisigScript(required int, keys [][]byte) []byte {
+	script := []byte{0x50 + byte(required)}
+	for _, k := range keys {
+		script = append(script, byte(len(k)))
+		script = append(script, k...)
+	}
+	return append(script, 0x50+byte(len(keys)), 0xae)
+}
+
+// signerHash derives the hash a spending condition's signer is identified by
+// from its public keys
+func signerHash(mode codec.HashMode, required int, keys [][]byte) ([]byte, error) {
+	switch mode {
+	case codec.P2PKH:
+		return hash160(keys[0]), nil
+	case codec.P2WPKH:
+		if len(keys[0]) != 33 {
+			return nil, errors.New("P2WPKH requires a compressed public key")
+		}
+		return hash160(append([]byte{0x00, 0x14}, hash160(keys[0])...)), nil
+	case codec.P2SH, codec.NSMS_P2SH:
+		return hash160(multisigScript(required, keys)), nil
+	case codec.P2WSH, codec.NSMS_P2WSH:
+		script := sha256.Sum256(multisigScript(required, keys))
+		return hash160(append([]byte{0x00, 0x20}, script[:]...)), nil
+	}
+	return nil, fmt.Errorf("unknown hash mode %d", mode)
+}
+
+// singleSigAddress is the address of a single public key
+func singleSigAddress(version codec.NetworkVersion, key []byte) string {
+	sc := codec.SpendingCondition{HashMode: codec.P2PKH}
+	copy(sc.PubKeyHash[:], hash160(key))
+	return spendingConditionAddress(version, &sc)
+}
+
+// clearedCondition serializes sc with its nonce, fee and signatures cleared,
+// as it is when computing the initial sighash
+func clearedCondition(sc *codec.SpendingCondition) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(sc.HashMode))
+	buf.Write(sc.PubKeyHash[:])
+	// nonce and fee
+	buf.Write(make([]byte, 16))
+	if sc.SingleSigCondition != nil {
+		buf.WriteByte(sc.SingleSigCondition.PublicKeyEncoding)
+		buf.Write(make([]byte, 65))
+	} else {
+		// no fields, but the same number of required signatures
+		buf.Write(make([]byte, 4))
+		binary.Write(&buf, binary.BigEndian, sc.MultiSigCondition.SignatureCount)
+	}
+	return buf.Bytes()
+}
+
+// initialSighash hashes raw, the serialized tx, with its authorization cleared.
+// A sponsor's condition is replaced by an empty single-sig one.
+func initialSighash(raw []byte, tx *codec.Transaction) ([]byte, error) {
+	n, err := txLength(raw)
+	if err != nil {
+		return nil, err
+	}
+	// version and chain id, then the authorization
+	r := bytes.NewReader(raw[5:n])
+	if err := skipBytes(r, 1); err != nil {
+		return nil, err
+	}
+	if err := skipSpendingCondition(r); err != nil {
+		return nil, err
+	}
+	if tx.Authorization.SponsorCondition != nil {
+		if err := skipSpendingCondition(r); err != nil {
+			return nil, err
+		}
+	}
+	rest := raw[n-r.Len() : n]
+
+	var buf bytes.Buffer
+	buf.Write(raw[:5])
+	buf.WriteByte(byte(tx.Authorization.Type))
+	buf.Write(clearedCondition(&tx.Authorization.OriginCondition))
+	if tx.Authorization.SponsorCondition != nil {
+		empty := codec.SpendingCondition{
+			HashMode:           codec.P2PKH,
+			SingleSigCondition: &codec.SingleSigSpendingCondition{},
+		}
+		buf.Write(clearedCondition(&empty))
+	}
+	buf.Write(rest)
+	return sha512_256(buf.Bytes()), nil
+}
+
+// verifyCondition checks the signatures of sc over sighash and that they
+// match its signer. It returns the sighash the next signer builds on.
+func verifyCondition(version codec.NetworkVersion, sc *codec.SpendingCondition, sighash []byte,
+	authFlag byte) (ConditionVerification, []byte) {
+	v := ConditionVerification{Signer: spendingConditionAddress(version, sc), Signers: []SignerVerification{}}
+	presign := presignSighash(sighash, authFlag, sc.Fee, sc.Nonce)
+
+	var keys [][]byte
+	next := sighash
+	switch {
+	case sc.SingleSigCondition != nil:
+		v.SignaturesRequired = 1
+		v.Signatures = 1
+		sig := sc.SingleSigCondition.Signature[:]
+		encoding := sc.SingleSigCondition.PublicKeyEncoding
+		key, err := recoverPublicKey(presign, sig, encoding == 0x00)
+		if err != nil {
+			v.Signers = append(v.Signers, SignerVerification{Signed: true, Error: err.Error()})
+			v.Error = "signature does not recover a public key"
+			return v, next
+		}
+		keys = append(keys, key)
+		v.Signers = append(v.Signers, SignerVerification{
+			PublicKey: hex.EncodeToString(key),
+			Address:   singleSigAddress(version, key),
+			Signed:    true,
+		})
+		next = postsignSighash(presign, encoding, sig)
+
+	case sc.MultiSigCondition != nil:
+		v.SignaturesRequired = int(sc.MultiSigCondition.SignatureCount)
+		// Order independent multisig signers all sign the same sighash,
+		// the legacy ones chain their signatures.
+		ordered := sc.HashMode == codec.P2SH || sc.HashMode == codec.P2WSH
+		for _, field := range sc.MultiSigCondition.Authorizations {
+			switch field.FieldID {
+			case 0x00, 0x01:
+				keys = append(keys, field.Body)
+				v.Signers = append(v.Signers, SignerVerification{
+					PublicKey: hex.EncodeToString(field.Body),
+					Address:   singleSigAddress(version, field.Body),
+				})
+			case 0x02, 0x03:
+				v.Signatures += 1
+				encoding := field.FieldID - 0x02
+				key, err := recoverPublicKey(presign, field.Body, encoding == 0x00)
+				if err != nil {
+					v.Signers = append(v.Signers, SignerVerification{Signed: true, Error: err.Error()})
+					v.Error = "signature does not recover a public key"
+					return v, next
+				}
+				keys = append(keys, key)
+				v.Signers = append(v.Signers, SignerVerification{
+					PublicKey: hex.EncodeToString(key),
+					Address:   singleSigAddress(version, key),
+					Signed:    true,
+				})
+				if ordered {
+					next = postsignSighash(presign, encoding, field.Body)
+					presign = presignSighash(next, authFlag, sc.Fee, sc.Nonce)
+				}
+			default:
+				v.Error = fmt.Sprintf("unknown multisig field %#x", field.FieldID)
+				return v, next
+			}
+		}
+		if !ordered {
+			// The next signer builds on the sighash this condition started from
+			next = sighash
+		}
+		// Order independent multisig accepts extra signatures
+		if v.Signatures < v.SignaturesRequired || (ordered && v.Signatures != v.SignaturesRequired) {
+			v.Error = fmt.Sprintf("%d signatures, %d required", v.Signatures, v.SignaturesRequired)
+			return v, next
+		}
+	}
+	if len(keys) == 0 {
+		v.Error = "no public keys"
+		return v, next
+	}
+
+	hash, err := signerHash(sc.HashMode, v.SignaturesRequired, keys)
+	if err != nil {
+		v.Error = err.Error()
+		return v, next
+	}
+	derived := *sc
+	copy(derived.PubKeyHash[:], hash)
+	v.DerivedSigner = spendingConditionAddress(version, &derived)
+	if v.DerivedSigner != v.Signer {
+		v.Error = "public keys don't match the signer"
+		return v, next
+	}
+	v.Valid = true
+	return v, next
+}
+
+// verifyTx checks every signature of tx, decoded from raw
+func verifyTx(raw []byte, tx *codec.Transaction) *TxVerification {
+	v := &TxVerification{}
+	sighash, err := initialSighash(raw, tx)
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+	v.InitialSighash = hex.EncodeToString(sighash)
+
+	var next []byte
+	v.Origin, next = verifyCondition(tx.Version, &tx.Authorization.OriginCondition, sighash, authStandard)
+	v.Valid = v.Origin.Valid
+	if tx.Authorization.SponsorCondition != nil {
+		sponsor, _ := verifyCondition(tx.Version, tx.Authorization.SponsorCondition, next, authSponsored)
+		v.Sponsor = &sponsor
+		v.Valid = v.Valid && sponsor.Valid
+	}
+	return v
+}